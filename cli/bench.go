@@ -0,0 +1,474 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/connector/pkg/config"
+	"openclaw-bridge/connector/pkg/connector"
+	"openclaw-bridge/shared/protocol"
+)
+
+// runBench implements `openclaw-cli bench`: it opens many sessions against a
+// relay, sends messages at a fixed rate and reports latency and throughput.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	relayURL := fs.String("relay-url", "ws://127.0.0.1:8080/client", "relay client websocket url")
+	accessCode := fs.String("access-code", "", "access code (generated when -connector is set)")
+	connectorMode := fs.String("connector", "", "start a built-in connector on the relay: echo (empty uses the registered connector)")
+	tunnelURL := fs.String("tunnel-url", "", "relay tunnel url for -connector (default derived from -relay-url)")
+	sessions := fs.Int("sessions", 10, "concurrent sessions")
+	messages := fs.Int("messages", 10, "messages sent per session")
+	rate := fs.Float64("rate", 0, "messages per second per session (0 sends the next message as soon as the reply ends)")
+	messageSize := fs.Int("message-size", 256, "text bytes per message")
+	imageCount := fs.Int("images", 0, "images attached to every message")
+	imageSize := fs.Int("image-size", 64, "width and height in pixels of generated PNG images")
+	ramp := fs.Duration("ramp", 0, "spread session connects evenly over this duration")
+	responseTimeout := fs.Duration("response-timeout", 30*time.Second, "max wait between events of one reply")
+	output := fs.String("output", "text", "report format: text or json")
+	_ = fs.Parse(args)
+
+	switch {
+	case *sessions <= 0 || *messages <= 0:
+		fmt.Fprintln(os.Stderr, "-sessions and -messages must be positive")
+		return exitUsage
+	case *messageSize < 1:
+		fmt.Fprintln(os.Stderr, "-message-size must be at least 1")
+		return exitUsage
+	case *output != "text" && *output != "json":
+		fmt.Fprintln(os.Stderr, "-output must be text or json")
+		return exitUsage
+	case *connectorMode != "" && *connectorMode != config.ModeEcho:
+		fmt.Fprintf(os.Stderr, "-connector must be %s or empty\n", config.ModeEcho)
+		return exitUsage
+	case *connectorMode == "" && strings.TrimSpace(*accessCode) == "":
+		fmt.Fprintln(os.Stderr, "-access-code is required without -connector")
+		return exitUsage
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if *connectorMode != "" {
+		if *accessCode == "" {
+			*accessCode = "bench-" + randomHex(8)
+		}
+		if *tunnelURL == "" {
+			if !strings.HasSuffix(*relayURL, "/client") {
+				fmt.Fprintln(os.Stderr, "-tunnel-url is required when -relay-url does not end in /client")
+				return exitUsage
+			}
+			*tunnelURL = strings.TrimSuffix(*relayURL, "/client") + "/tunnel"
+		}
+		if err := startEchoConnector(ctx, *tunnelURL, *accessCode); err != nil {
+			fmt.Fprintf(os.Stderr, "error: built-in connector: %v\n", err)
+			return exitError
+		}
+		if err := waitConnector(ctx, *relayURL, *accessCode, 10*time.Second); err != nil {
+			fmt.Fprintf(os.Stderr, "error: built-in connector: %v\n", err)
+			return exitOffline
+		}
+	}
+
+	event := protocol.Event{Type: protocol.EventUserMessage, Content: benchText(*messageSize)}
+	if *imageCount > 0 {
+		img, err := benchImage(*imageSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: generate image: %v\n", err)
+			return exitError
+		}
+		for i := 0; i < *imageCount; i++ {
+			event.Images = append(event.Images, img)
+		}
+	}
+
+	b := &bench{
+		relayURL:        *relayURL,
+		accessCode:      *accessCode,
+		sessions:        *sessions,
+		messages:        *messages,
+		ramp:            *ramp,
+		responseTimeout: *responseTimeout,
+		event:           event,
+		stats:           benchStats{errors: make(map[string]int)},
+	}
+	if *rate > 0 {
+		b.interval = time.Duration(float64(time.Second) / *rate)
+	}
+	if payload, err := protocol.EncodeEvent(event); err == nil {
+		b.messageBytes = len(payload)
+	}
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < b.sessions; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			b.runSession(ctx, index)
+		}(i)
+	}
+	wg.Wait()
+
+	report := b.stats.report(b.sessions, time.Since(started))
+	if *output == "json" {
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Fprintf(os.Stdout, "%s\n", out)
+	} else {
+		report.print(os.Stdout)
+	}
+	if report.Errors > 0 || report.SessionsFailed > 0 {
+		return exitError
+	}
+	return exitOK
+}
+
+type bench struct {
+	relayURL        string
+	accessCode      string
+	sessions        int
+	messages        int
+	interval        time.Duration
+	ramp            time.Duration
+	responseTimeout time.Duration
+	event           protocol.Event
+	messageBytes    int
+
+	stats benchStats
+}
+
+func (b *bench) runSession(ctx context.Context, index int) {
+	if b.ramp > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.ramp * time.Duration(index) / time.Duration(b.sessions)):
+		}
+	}
+
+	started := time.Now()
+	sess, err := client.Dial(ctx, b.relayURL, b.accessCode, client.Options{EventBuffer: 256})
+	if err != nil {
+		code := "CONNECT_FAILED"
+		var connectErr *client.ConnectError
+		if errors.As(err, &connectErr) {
+			code = connectErr.Code
+		}
+		b.stats.connectFailed(code)
+		return
+	}
+	b.stats.connected(time.Since(started))
+	defer sess.Close()
+
+	next := time.Now()
+	for i := 0; i < b.messages; i++ {
+		if b.interval > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Until(next)):
+			}
+			next = next.Add(b.interval)
+		}
+		if ctx.Err() != nil || !b.exchange(ctx, sess, fmt.Sprintf("b%d-%d", index, i)) {
+			return
+		}
+	}
+}
+
+// exchange sends one message and waits for its end or error event. It
+// reports false when the session cannot continue.
+func (b *bench) exchange(ctx context.Context, sess *client.Session, id string) bool {
+	event := b.event
+	event.ID = id
+	sent := time.Now()
+	if err := sess.Send(event); err != nil {
+		b.stats.failed("SEND_FAILED")
+		return false
+	}
+	b.stats.sent(b.messageBytes)
+
+	var firstToken time.Duration
+	tokens, replyBytes := 0, 0
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(b.responseTimeout):
+			b.stats.failed("RESPONSE_TIMEOUT")
+			return false
+		case ev, ok := <-sess.Events():
+			if !ok {
+				b.stats.failed("CONNECTION_LOST")
+				return false
+			}
+			switch ev.Type {
+			case protocol.EventToken:
+				if tokens == 0 {
+					firstToken = time.Since(sent)
+				}
+				tokens++
+				replyBytes += len(ev.Content)
+			case protocol.EventEnd:
+				b.stats.replied(firstToken, time.Since(sent), tokens, replyBytes)
+				return true
+			case protocol.EventError:
+				b.stats.failed(ev.Code)
+				return ev.Code != "CONNECTION_LOST"
+			}
+		}
+	}
+}
+
+// startEchoConnector registers an in-process echo connector for accessCode,
+// so a bench can run against a local relay without any agent.
+func startEchoConnector(ctx context.Context, tunnelURL, accessCode string) error {
+	logger := log.New(io.Discard, "", 0)
+	cfg := config.Config{
+		RelayURL:       tunnelURL,
+		AccessCodeHash: protocol.HashAccessCode(accessCode),
+		Mode:           config.ModeEcho,
+	}
+
+	conn, err := connector.New(cfg, logger, connector.Options{})
+	if err != nil {
+		return err
+	}
+	go func() { _ = conn.Run(ctx) }()
+	return nil
+}
+
+// waitConnector polls until a connector is registered for accessCode.
+func waitConnector(ctx context.Context, relayURL, accessCode string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		sess, err := client.Dial(ctx, relayURL, accessCode, client.Options{})
+		if err == nil {
+			_ = sess.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// benchText returns size bytes of space-separated words, so the echo
+// backend streams a realistic number of tokens.
+func benchText(size int) string {
+	words := []string{"relay", "bridge", "session", "token", "stream", "latency", "gateway", "connector"}
+	var b strings.Builder
+	for i := 0; b.Len() < size; i++ {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(words[i%len(words)])
+	}
+	return b.String()[:size]
+}
+
+// benchImage returns a noisy PNG, which compresses about as badly as a
+// photo of the same size.
+func benchImage(size int) (protocol.ImageItem, error) {
+	img := image.NewRGBA(image.Rect(0, 0, max(size, 1), max(size, 1)))
+	rng := rand.New(rand.NewSource(1))
+	for i := range img.Pix {
+		img.Pix[i] = byte(rng.Intn(256))
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return protocol.ImageItem{}, err
+	}
+	return protocol.ImageItem{Data: base64.StdEncoding.EncodeToString(buf.Bytes()), MimeType: "image/png"}, nil
+}
+
+type benchStats struct {
+	mu sync.Mutex
+
+	connect    []time.Duration
+	firstToken []time.Duration
+	latency    []time.Duration
+
+	sessionsFailed int
+	messagesSent   int
+	completed      int
+	tokens         int
+	sentBytes      int64
+	replyBytes     int64
+	errors         map[string]int
+}
+
+func (s *benchStats) connected(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connect = append(s.connect, d)
+}
+
+func (s *benchStats) connectFailed(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessionsFailed++
+	s.errors[code]++
+}
+
+func (s *benchStats) sent(bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messagesSent++
+	s.sentBytes += int64(bytes)
+}
+
+func (s *benchStats) replied(firstToken, latency time.Duration, tokens, bytes int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completed++
+	s.tokens += tokens
+	s.replyBytes += int64(bytes)
+	if tokens > 0 {
+		s.firstToken = append(s.firstToken, firstToken)
+	}
+	s.latency = append(s.latency, latency)
+}
+
+func (s *benchStats) failed(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[code]++
+}
+
+// benchReport is the -output json document. Durations are milliseconds.
+type benchReport struct {
+	Sessions          int            `json:"sessions"`
+	SessionsFailed    int            `json:"sessions_failed"`
+	MessagesSent      int            `json:"messages_sent"`
+	Completed         int            `json:"completed"`
+	Errors            int            `json:"errors"`
+	ErrorRate         float64        `json:"error_rate"`
+	WallMs            float64        `json:"wall_ms"`
+	ConnectMs         percentiles    `json:"connect_ms"`
+	FirstTokenMs      percentiles    `json:"first_token_ms"`
+	LatencyMs         percentiles    `json:"latency_ms"`
+	MessagesPerSecond float64        `json:"messages_per_second"`
+	TokensPerSecond   float64        `json:"tokens_per_second"`
+	SentBytesPerSec   float64        `json:"sent_bytes_per_second"`
+	ReplyBytesPerSec  float64        `json:"reply_bytes_per_second"`
+	ErrorCodes        map[string]int `json:"error_codes,omitempty"`
+}
+
+type percentiles struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+func (s *benchStats) report(sessions int, wall time.Duration) benchReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := benchReport{
+		Sessions:       sessions,
+		SessionsFailed: s.sessionsFailed,
+		MessagesSent:   s.messagesSent,
+		Completed:      s.completed,
+		WallMs:         milliseconds(wall),
+		ConnectMs:      percentilesOf(s.connect),
+		FirstTokenMs:   percentilesOf(s.firstToken),
+		LatencyMs:      percentilesOf(s.latency),
+	}
+	if len(s.errors) > 0 {
+		r.ErrorCodes = s.errors
+	}
+	for _, n := range s.errors {
+		r.Errors += n
+	}
+	// Connect failures count as failed attempts alongside failed messages.
+	if attempts := s.messagesSent + s.sessionsFailed; attempts > 0 {
+		r.ErrorRate = float64(r.Errors) / float64(attempts)
+	}
+	if seconds := wall.Seconds(); seconds > 0 {
+		r.MessagesPerSecond = float64(s.completed) / seconds
+		r.TokensPerSecond = float64(s.tokens) / seconds
+		r.SentBytesPerSec = float64(s.sentBytes) / seconds
+		r.ReplyBytesPerSec = float64(s.replyBytes) / seconds
+	}
+	return r
+}
+
+func (r benchReport) print(w io.Writer) {
+	fmt.Fprintf(w, "sessions   %d (%d failed to connect)\n", r.Sessions, r.SessionsFailed)
+	fmt.Fprintf(w, "messages   %d sent, %d completed, %d errors (%.2f%%)\n", r.MessagesSent, r.Completed, r.Errors, r.ErrorRate*100)
+	fmt.Fprintf(w, "wall       %.0f ms\n", r.WallMs)
+	fmt.Fprintf(w, "%-10s %8s %10s %10s %10s %10s %10s\n", "ms", "count", "mean", "p50", "p90", "p99", "max")
+	for _, row := range []struct {
+		name string
+		p    percentiles
+	}{{"connect", r.ConnectMs}, {"ttft", r.FirstTokenMs}, {"latency", r.LatencyMs}} {
+		fmt.Fprintf(w, "%-10s %8d %10.2f %10.2f %10.2f %10.2f %10.2f\n", row.name, row.p.Count, row.p.Mean, row.p.P50, row.p.P90, row.p.P99, row.p.Max)
+	}
+	fmt.Fprintf(w, "throughput %.1f msg/s, %.1f tokens/s, sent %.1f KiB/s, received %.1f KiB/s\n",
+		r.MessagesPerSecond, r.TokensPerSecond, r.SentBytesPerSec/1024, r.ReplyBytesPerSec/1024)
+
+	codes := make([]string, 0, len(r.ErrorCodes))
+	for code := range r.ErrorCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "error      %s x%d\n", code, r.ErrorCodes[code])
+	}
+}
+
+func percentilesOf(samples []time.Duration) percentiles {
+	if len(samples) == 0 {
+		return percentiles{}
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+	rank := func(q float64) float64 {
+		return milliseconds(sorted[min(len(sorted)-1, int(q*float64(len(sorted))))])
+	}
+	return percentiles{
+		Count: len(sorted),
+		Mean:  milliseconds(total / time.Duration(len(sorted))),
+		P50:   rank(0.50),
+		P90:   rank(0.90),
+		P99:   rank(0.99),
+		Max:   milliseconds(sorted[len(sorted)-1]),
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -2,48 +2,178 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
-	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/gorilla/websocket"
-
+	"openclaw-bridge/client"
 	"openclaw-bridge/shared/protocol"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServe(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:]))
+	}
+
 	relayURL := flag.String("relay-url", "ws://127.0.0.1:8080/client", "relay client websocket url")
 	accessCode := flag.String("access-code", "", "access code")
 	responseTimeout := flag.Duration("response-timeout", 45*time.Second, "max wait per prompt before timing out")
 	reconnect := flag.Bool("reconnect", true, "auto reconnect when relay connection is lost")
 	reconnectDelay := flag.Duration("reconnect-delay", 2*time.Second, "delay between reconnect attempts")
+	eventsFlag := flag.String("events", "", "comma-separated optional events to receive: tool_call,tool_result,reasoning,status,media")
+	mediaDir := flag.String("media-dir", defaultMediaDir(), "directory where received media files are saved")
+	prompt := flag.String("prompt", "", "send this prompt, print the reply and exit")
+	promptFile := flag.String("prompt-file", "", "send the contents of this file as a one-shot prompt")
+	var imagePaths stringList
+	flag.Var(&imagePaths, "image", "image file to attach to the one-shot prompt (repeatable)")
+	output := flag.String("output", "text", "one-shot output: text, json or ndjson")
+	format := flag.String("format", "text", "session format: text, or ndjson to exchange raw protocol events on stdin/stdout")
+	tuiMode := flag.Bool("tui", false, "full-screen terminal UI with line editing, history and slash commands")
+	historyFile := flag.String("history-file", defaultHistoryFile(), "TUI input history file (empty disables history)")
+	transcriptPath := flag.String("transcript", "", "append the conversation to this file (defaults to -resume-transcript)")
+	transcriptFmt := flag.String("transcript-format", "", "transcript format: markdown or jsonl (default from the file extension)")
+	resumePath := flag.String("resume-transcript", "", "print this transcript before starting and keep appending to it")
 	flag.Parse()
 
 	if strings.TrimSpace(*accessCode) == "" {
 		log.Fatal("-access-code is required")
 	}
 
-	conn, sessionID, err := connectSession(*relayURL, *accessCode)
+	caps, err := parseEventCaps(*eventsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch *format {
+	case "text":
+	case "ndjson":
+		os.Exit(runTap(*relayURL, *accessCode, caps, *responseTimeout))
+	default:
+		fmt.Fprintf(os.Stderr, "-format must be text or ndjson\n")
+		os.Exit(exitUsage)
+	}
+
+	if *transcriptPath == "" {
+		*transcriptPath = *resumePath
+	}
+	recordFormat, err := transcriptFormat(*transcriptPath, *transcriptFmt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "-transcript-format: %v\n", err)
+		os.Exit(exitUsage)
+	}
+	// The resumed conversation is loaded before the transcript file is
+	// opened for appending; one-shot mode does not print it so stdout
+	// carries the reply alone.
+	var resumed strings.Builder
+	record := &transcript{format: recordFormat}
+	if *resumePath != "" {
+		if err := resumeTranscript(&resumed, *resumePath, record); err != nil {
+			fmt.Fprintf(os.Stderr, "error: resume transcript: %v\n", err)
+			os.Exit(exitUsage)
+		}
+	}
+	if *transcriptPath != "" {
+		file, err := openTranscript(*transcriptPath, recordFormat)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: open transcript: %v\n", err)
+			os.Exit(exitError)
+		}
+		file.entries = record.entries
+		record = file
+	}
+	defer record.close()
+
+	if *tuiMode {
+		os.Exit(runTUI(tuiOptions{
+			relayURL:        *relayURL,
+			accessCode:      *accessCode,
+			caps:            caps,
+			responseTimeout: *responseTimeout,
+			reconnectDelay:  *reconnectDelay,
+			mediaDir:        *mediaDir,
+			historyPath:     *historyFile,
+			record:          record,
+			resumed:         resumed.String(),
+		}))
+	}
+
+	if *prompt != "" || *promptFile != "" || len(imagePaths) > 0 || stdinPiped() {
+		switch *output {
+		case "text", "json", "ndjson":
+		default:
+			fmt.Fprintf(os.Stderr, "-output must be text, json or ndjson\n")
+			os.Exit(exitUsage)
+		}
+		event, err := buildPrompt(*prompt, *promptFile, imagePaths)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(exitUsage)
+		}
+		os.Exit(oneShot{
+			relayURL:        *relayURL,
+			accessCode:      *accessCode,
+			caps:            caps,
+			responseTimeout: *responseTimeout,
+			mediaDir:        *mediaDir,
+			output:          *output,
+			record:          record,
+		}.run(event))
+	}
+
+	sess, err := client.Dial(context.Background(), *relayURL, *accessCode, client.Options{
+		Caps:           caps,
+		Reconnect:      *reconnect,
+		ReconnectDelay: *reconnectDelay,
+		OnDisconnect: func(err error) {
+			if *reconnect {
+				fmt.Printf("\nconnection lost, reconnecting... err=%v\n", err)
+			}
+		},
+		OnReconnect: func(sessionID string) {
+			fmt.Printf("reconnected session=%s\n", sessionID)
+		},
+	})
 	if err != nil {
 		log.Fatalf("connect failed: %v", err)
 	}
-	defer conn.Close()
-	fmt.Printf("connected session=%s\n", sessionID)
+	fmt.Print(resumed.String())
+	fmt.Printf("connected session=%s\n", sess.ID())
+	events := sess.Events()
 
-	events := make(chan protocol.Event, 16)
-	errs := make(chan error, 1)
-	go readLoop(conn, sessionID, events, errs)
+	// Ctrl+C stops a streaming reply; a second Ctrl+C, or one at the
+	// prompt, closes the session.
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	lines := readLines(os.Stdin)
 
-	scanner := bufio.NewScanner(os.Stdin)
 	fmt.Println("enter text and press Enter (Ctrl+D to quit)")
 	fmt.Println("tip: prefix with json: to send a full event payload (images field)")
-	for scanner.Scan() {
-		line := scanner.Text()
+	fmt.Println("tip: Ctrl+C stops a reply, Ctrl+C again closes the session")
+input:
+	for {
+		var line string
+		select {
+		case <-interrupts:
+			fmt.Println()
+			break input
+		case next, ok := <-lines:
+			if !ok {
+				break input
+			}
+			line = next
+		}
 		if strings.TrimSpace(line) == "" {
 			continue
 		}
@@ -64,59 +194,47 @@ func main() {
 			}
 		}
 
-		eventPayload, err := protocol.EncodeEvent(outboundEvent)
-		if err != nil {
-			log.Printf("encode event error=%v", err)
-			continue
-		}
-		frame, err := protocol.BuildDataFrame(sessionID, 0, eventPayload)
-		if err != nil {
-			log.Printf("build frame error=%v", err)
-			continue
+		if err := sess.Send(outboundEvent); err != nil {
+			log.Fatalf("send user_message error=%v", err)
 		}
-		if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
-			if !*reconnect {
-				log.Fatalf("send user_message error=%v", err)
-			}
-			fmt.Printf("connection lost, reconnecting... err=%v\n", err)
-			conn, sessionID, events, errs, err = reconnectSession(conn, *relayURL, *accessCode, *reconnectDelay)
-			if err != nil {
-				log.Fatalf("reconnect failed: %v", err)
-			}
-			frame, err = protocol.BuildDataFrame(sessionID, 0, eventPayload)
-			if err != nil {
-				log.Fatalf("build frame after reconnect error=%v", err)
-			}
-			if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
-				log.Fatalf("send user_message after reconnect error=%v", err)
-			}
+		if outboundEvent.Type == protocol.EventUserMessage {
+			record.userMessage(sess.ID(), outboundEvent)
 		}
 
+		view := renderState{mediaDir: *mediaDir}
+		var reply strings.Builder
+		stopping := false
 		for {
 			select {
-			case err := <-errs:
-				if !*reconnect {
-					log.Fatalf("read error=%v", err)
+			case <-interrupts:
+				view.enter(os.Stdout, "", "")
+				if stopping {
+					break input
 				}
-				fmt.Printf("\nconnection lost, reconnecting... err=%v\n", err)
-				conn, sessionID, events, errs, err = reconnectSession(conn, *relayURL, *accessCode, *reconnectDelay)
-				if err != nil {
-					log.Fatalf("reconnect failed: %v", err)
+				stopping = true
+				if err := sess.Stop(outboundEvent.ID); err != nil {
+					fmt.Printf("error: send stop: %v\n", err)
+					break input
 				}
-				fmt.Printf("request interrupted, please resend your message\n")
-				goto nextInput
+				fmt.Println("[stopping] press Ctrl+C again to close the session")
 			case <-time.After(*responseTimeout):
-				fmt.Printf("\nerror: RESPONSE_TIMEOUT no terminal event within %s\n", responseTimeout.String())
+				message := fmt.Sprintf("no terminal event within %s", responseTimeout.String())
+				fmt.Printf("\nerror: RESPONSE_TIMEOUT %s\n", message)
+				record.reply(sess.ID(), reply.String(), protocol.Event{Type: protocol.EventError, ID: outboundEvent.ID, Code: "RESPONSE_TIMEOUT", Message: message})
 				goto nextInput
-			case ev := <-events:
-				switch ev.Type {
-				case protocol.EventToken:
-					fmt.Print(ev.Content)
-				case protocol.EventEnd:
-					fmt.Println()
-					goto nextInput
-				case protocol.EventError:
-					fmt.Printf("\nerror: %s %s\n", ev.Code, ev.Message)
+			case ev, ok := <-events:
+				if !ok {
+					log.Fatalf("session ended error=%v", sess.Err())
+				}
+				view.render(os.Stdout, ev)
+				if ev.Type == protocol.EventToken {
+					reply.WriteString(ev.Content)
+				}
+				if ev.Type == protocol.EventEnd || ev.Type == protocol.EventError {
+					record.reply(sess.ID(), reply.String(), ev)
+					if ev.Code == "CONNECTION_LOST" {
+						fmt.Printf("request interrupted, please resend your message\n")
+					}
 					goto nextInput
 				}
 			}
@@ -124,119 +242,42 @@ func main() {
 	nextInput:
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Printf("stdin error=%v", err)
-	}
-
-	closeData, _ := protocol.EncodeControl(protocol.ControlMessage{Type: protocol.TypeCloseSession, SessionID: sessionID})
-	_ = conn.WriteMessage(websocket.TextMessage, closeData)
-}
-
-func reconnectSession(oldConn *websocket.Conn, relayURL, accessCode string, delay time.Duration) (*websocket.Conn, string, chan protocol.Event, chan error, error) {
-	if oldConn != nil {
-		_ = oldConn.Close()
-	}
-	for {
-		conn, sessionID, err := connectSession(relayURL, accessCode)
-		if err == nil {
-			fmt.Printf("reconnected session=%s\n", sessionID)
-			events := make(chan protocol.Event, 16)
-			errs := make(chan error, 1)
-			go readLoop(conn, sessionID, events, errs)
-			return conn, sessionID, events, errs, nil
-		}
-		fmt.Printf("reconnect attempt failed: %v\n", err)
-		time.Sleep(delay)
-	}
+	sessionID := sess.ID()
+	_ = sess.Close()
+	fmt.Printf("session closed session=%s\n", sessionID)
 }
 
-func connectSession(relayURL, accessCode string) (*websocket.Conn, string, error) {
-	conn, _, err := websocket.DefaultDialer.Dial(relayURL, nil)
-	if err != nil {
-		return nil, "", fmt.Errorf("connect relay: %w", err)
-	}
-
-	connectData, err := protocol.EncodeControl(protocol.ControlMessage{
-		Type:       protocol.TypeConnect,
-		AccessCode: accessCode,
-		E2EE:       false,
-	})
-	if err != nil {
-		_ = conn.Close()
-		return nil, "", fmt.Errorf("encode connect: %w", err)
-	}
-	if err := conn.WriteMessage(websocket.TextMessage, connectData); err != nil {
-		_ = conn.Close()
-		return nil, "", fmt.Errorf("send connect: %w", err)
-	}
-
-	sessionID, err := waitConnectOK(conn)
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		_ = conn.Close()
-		return nil, "", err
+		return ""
 	}
-	return conn, sessionID, nil
+	return filepath.Join(home, ".openclaw_cli_history")
 }
 
-func waitConnectOK(conn *websocket.Conn) (string, error) {
-	for {
-		msgType, data, err := conn.ReadMessage()
-		if err != nil {
-			return "", err
-		}
-		if msgType != websocket.TextMessage {
-			continue
-		}
-		msg, err := protocol.DecodeControl(data)
-		if err != nil {
-			continue
-		}
-		switch msg.Type {
-		case protocol.TypeConnectOK:
-			if msg.SessionID == "" {
-				return "", fmt.Errorf("missing session_id")
-			}
-			return msg.SessionID, nil
-		case protocol.TypeError:
-			return "", fmt.Errorf("connect error %s: %s", msg.Code, msg.Message)
-		}
+// defaultMediaDir keeps received media out of the working directory, since
+// file names are chosen by the agent.
+func defaultMediaDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "openclaw-cli-media")
 	}
+	return filepath.Join(dir, "openclaw-cli", "media")
 }
 
-func readLoop(conn *websocket.Conn, sessionID string, out chan<- protocol.Event, errs chan<- error) {
-	for {
-		msgType, data, err := conn.ReadMessage()
-		if err != nil {
-			select {
-			case errs <- err:
-			default:
-			}
-			return
-		}
-		if msgType != websocket.BinaryMessage {
-			continue
-		}
-
-		sid, _, payload, err := protocol.ParseDataFrame(data)
-		if err != nil {
-			continue
-		}
-		if sid != sessionID {
-			continue
-		}
-
-		event, err := protocol.DecodeEvent(payload)
-		if err != nil {
-			continue
+// readLines delivers stdin lines on a channel, closed at EOF, so the prompt
+// can wait for input and signals at the same time.
+func readLines(r io.Reader) <-chan string {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
 		}
-		select {
-		case out <- event:
-		default:
-			select {
-			case errs <- errors.New("event queue overflow"):
-			default:
-			}
-			return
+		if err := scanner.Err(); err != nil {
+			log.Printf("stdin error=%v", err)
 		}
-	}
+	}()
+	return lines
 }
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	ansiReset     = "\x1b[0m"
+	ansiBold      = "\x1b[1m"
+	ansiDim       = "\x1b[2m"
+	ansiUnderline = "\x1b[4m"
+	ansiCyan      = "\x1b[36m"
+)
+
+// markdownRenderer styles complete lines of a streamed markdown reply. It
+// only tracks whether it is inside a fenced code block.
+type markdownRenderer struct {
+	inFence bool
+}
+
+func (m *markdownRenderer) line(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "```") {
+		m.inFence = !m.inFence
+		return ansiDim + s + ansiReset
+	}
+	if m.inFence {
+		return ansiCyan + s + ansiReset
+	}
+
+	indent := s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+	switch {
+	case strings.HasPrefix(trimmed, "#"):
+		text := strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		return indent + ansiBold + ansiUnderline + inlineMarkdown(text) + ansiReset
+	case strings.HasPrefix(trimmed, "- "), strings.HasPrefix(trimmed, "* "), strings.HasPrefix(trimmed, "+ "):
+		return indent + "• " + inlineMarkdown(trimmed[2:])
+	case strings.HasPrefix(trimmed, ">"):
+		return indent + ansiDim + "│ " + inlineMarkdown(strings.TrimSpace(trimmed[1:])) + ansiReset
+	}
+	return inlineMarkdown(s)
+}
+
+// inlineMarkdown styles **bold** and `code` spans; unmatched markers are
+// left as they are.
+func inlineMarkdown(s string) string {
+	var b strings.Builder
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "`"):
+			if end := strings.Index(s[1:], "`"); end >= 0 {
+				b.WriteString(ansiCyan + s[1:1+end] + ansiReset)
+				s = s[end+2:]
+				continue
+			}
+		case strings.HasPrefix(s, "**"):
+			if end := strings.Index(s[2:], "**"); end > 0 {
+				b.WriteString(ansiBold + s[2:2+end] + ansiReset)
+				s = s[end+4:]
+				continue
+			}
+		}
+		b.WriteByte(s[0])
+		s = s[1:]
+	}
+	return b.String()
+}
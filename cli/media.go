@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// saveMedia writes inline media into dir and returns the file path. Existing
+// files are never overwritten: a clashing name gets a numeric suffix.
+func saveMedia(dir string, media *protocol.MediaInfo) (string, error) {
+	if media.Data == "" {
+		return "", fmt.Errorf("no media content received")
+	}
+	data, err := base64.StdEncoding.DecodeString(media.Data)
+	if err != nil {
+		return "", err
+	}
+
+	name := filepath.Base(strings.TrimSpace(media.Name))
+	if name == "" || name == "." || name == ".." || name == string(filepath.Separator) {
+		name = "media-" + time.Now().Format("20060102-150405.000")
+		if exts, _ := mime.ExtensionsByType(media.MimeType); len(exts) > 0 {
+			name += exts[0]
+		}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 0; i < maxMediaNameAttempts; i++ {
+		path := filepath.Join(dir, name)
+		if i > 0 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", stem, i, ext))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(data); err != nil {
+			_ = f.Close()
+			_ = os.Remove(path)
+			return "", err
+		}
+		return path, f.Close()
+	}
+	return "", fmt.Errorf("no free file name for %s in %s", name, dir)
+}
+
+// maxMediaNameAttempts bounds the suffixes tried for a clashing name.
+const maxMediaNameAttempts = 1000
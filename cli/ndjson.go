@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/shared/protocol"
+)
+
+// tapLine is one line of -format ndjson output. Stdin accepts the same shape,
+// or a bare event object.
+type tapLine struct {
+	TS         string                   `json:"ts"`
+	SessionID  string                   `json:"session_id,omitempty"`
+	Dir        string                   `json:"dir"`
+	Kind       string                   `json:"kind"`
+	Flags      byte                     `json:"flags,omitempty"`
+	Control    *protocol.ControlMessage `json:"control,omitempty"`
+	Event      *protocol.Event          `json:"event,omitempty"`
+	Attachment *tapAttachment           `json:"attachment,omitempty"`
+	Error      string                   `json:"error,omitempty"`
+}
+
+type tapAttachment struct {
+	ID     string `json:"id"`
+	Offset uint64 `json:"offset"`
+	Final  bool   `json:"final"`
+	Size   int    `json:"size"`
+}
+
+// tap drives a session with NDJSON: every frame sent or received is written
+// to out as one line.
+type tap struct {
+	conn      *websocket.Conn
+	sessionID string
+	caps      protocol.Caps
+	timeout   time.Duration
+
+	outMu sync.Mutex
+	out   io.Writer
+
+	// inflight counts unfinished user_messages by event id.
+	inflightMu sync.Mutex
+	inflight   map[string]int
+	settled    chan struct{}
+	closing    atomic.Bool
+}
+
+// runTap connects, streams stdin lines to the session and mirrors all
+// traffic to stdout. It returns the process exit code.
+func runTap(relayURL, accessCode string, caps *protocol.Caps, timeout time.Duration) int {
+	t := &tap{out: os.Stdout, timeout: timeout, inflight: map[string]int{}, settled: make(chan struct{}, 1)}
+
+	// The tap keeps the raw connection so it can log attachment chunks and
+	// control messages that a client.Session would consume.
+	conn, _, err := client.DefaultDialer.Dial(relayURL, nil)
+	if err != nil {
+		t.write(tapLine{Dir: "local", Kind: "error", Error: fmt.Sprintf("connect relay: %v", err)})
+		return exitError
+	}
+	ok, err := client.Handshake(conn, accessCode, caps)
+	if err != nil {
+		_ = conn.Close()
+		t.write(tapLine{Dir: "local", Kind: "error", Error: err.Error()})
+		var connectErr *client.ConnectError
+		if errors.As(err, &connectErr) && connectErr.Code == "CONNECTOR_NOT_FOUND" {
+			return exitOffline
+		}
+		return exitError
+	}
+	t.conn, t.sessionID, t.caps = conn, ok.SessionID, *ok.Caps
+	// Handshake has already exchanged these; record them for the tap
+	// without the access code.
+	connect := client.ConnectMessage("", caps)
+	t.write(tapLine{Dir: "out", Kind: "control", Control: &connect})
+	t.write(tapLine{Dir: "in", Kind: "control", Control: &ok})
+
+	closed := make(chan struct{})
+	go func() {
+		t.readLoop()
+		close(closed)
+	}()
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64<<10), 32<<20)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := t.send([]byte(line)); err != nil {
+			t.write(tapLine{Dir: "local", Kind: "error", Error: err.Error()})
+		}
+		select {
+		case <-closed:
+			return exitError
+		default:
+		}
+	}
+
+	code := t.drain(closed)
+	t.closing.Store(true)
+	closeMsg := protocol.ControlMessage{Type: protocol.TypeCloseSession, V: protocol.Version, SessionID: ok.SessionID}
+	closeData, _ := protocol.EncodeControl(closeMsg)
+	conn.EnableWriteCompression(true)
+	if err := conn.WriteMessage(websocket.TextMessage, closeData); err == nil {
+		t.write(tapLine{Dir: "out", Kind: "control", Control: &closeMsg})
+	}
+	_ = conn.Close()
+	return code
+}
+
+// send writes one stdin line to the session: a control message when it is a
+// tap line with "control", otherwise an event.
+func (t *tap) send(line []byte) error {
+	var in tapLine
+	if err := json.Unmarshal(line, &in); err != nil {
+		return fmt.Errorf("invalid json line: %w", err)
+	}
+	if in.Control != nil {
+		msg := *in.Control
+		if msg.SessionID == "" {
+			msg.SessionID = t.sessionID
+		}
+		data, err := protocol.EncodeControl(msg)
+		if err != nil {
+			return err
+		}
+		t.conn.EnableWriteCompression(true)
+		if err := t.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			return err
+		}
+		t.write(tapLine{Dir: "out", Kind: "control", Control: &msg})
+		return nil
+	}
+
+	event := in.Event
+	if event == nil {
+		event = &protocol.Event{}
+		if err := json.Unmarshal(line, event); err != nil {
+			return fmt.Errorf("invalid event: %w", err)
+		}
+	}
+	if event.Type == "" {
+		event.Type = protocol.EventUserMessage
+	}
+	payload, err := protocol.EncodeEvent(*event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	flags, payload := protocol.CompressPayload(t.caps.CompressionAlgorithm(), 0, payload)
+	frame, err := protocol.BuildDataFrame(t.sessionID, flags, payload)
+	if err != nil {
+		return fmt.Errorf("build frame: %w", err)
+	}
+	if event.Type == protocol.EventUserMessage {
+		t.track(event.ID, 1)
+	}
+	t.conn.EnableWriteCompression(protocol.WireCompressible(flags))
+	if err := t.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		if event.Type == protocol.EventUserMessage {
+			t.track(event.ID, -1)
+		}
+		return err
+	}
+	t.write(tapLine{Dir: "out", Kind: "event", Flags: flags, Event: event})
+	return nil
+}
+
+// drain waits after stdin is exhausted until every sent user_message has
+// ended, the connection closes or no event arrives within the timeout.
+func (t *tap) drain(closed <-chan struct{}) int {
+	for t.pending() > 0 {
+		select {
+		case <-t.settled:
+		case <-closed:
+			return exitError
+		case <-time.After(t.timeout):
+			t.write(tapLine{Dir: "local", Kind: "error", Error: fmt.Sprintf("RESPONSE_TIMEOUT no terminal event within %s", t.timeout)})
+			return exitTimeout
+		}
+	}
+	return exitOK
+}
+
+func (t *tap) readLoop() {
+	for {
+		msgType, data, err := t.conn.ReadMessage()
+		if err != nil {
+			if !t.closing.Load() {
+				t.write(tapLine{Dir: "local", Kind: "error", Error: err.Error()})
+			}
+			return
+		}
+		if msgType == websocket.TextMessage {
+			msg, err := protocol.DecodeControl(data)
+			if err != nil {
+				t.write(tapLine{Dir: "in", Kind: "control", Error: err.Error()})
+				continue
+			}
+			t.write(tapLine{Dir: "in", Kind: "control", Control: &msg})
+			continue
+		}
+
+		sid, flags, payload, err := protocol.ParseDataFrame(data)
+		if err != nil {
+			t.write(tapLine{Dir: "in", Kind: "event", Error: err.Error()})
+			continue
+		}
+		line := tapLine{SessionID: sid, Dir: "in", Flags: flags}
+		flags, payload, err = protocol.DecompressPayload(t.caps.CompressionAlgorithm(), flags, payload, t.caps.MaxFrameSize)
+		if err != nil {
+			line.Kind = "event"
+			line.Error = err.Error()
+			t.write(line)
+			continue
+		}
+		if flags&protocol.FlagAttachment != 0 {
+			line.Kind = "attachment"
+			chunk, err := protocol.DecodeAttachmentChunk(payload)
+			if err != nil {
+				line.Error = err.Error()
+			} else {
+				line.Attachment = &tapAttachment{ID: chunk.ID, Offset: chunk.Offset, Final: chunk.Final, Size: len(chunk.Data)}
+			}
+			t.write(line)
+			continue
+		}
+
+		line.Kind = "event"
+		event, err := protocol.DecodeEvent(payload)
+		if err != nil {
+			line.Error = err.Error()
+			t.write(line)
+			continue
+		}
+		line.Event = &event
+		t.write(line)
+		if event.Type == protocol.EventEnd || event.Type == protocol.EventError {
+			if t.track(event.ID, -1) {
+				select {
+				case t.settled <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}
+}
+
+// track adjusts the unfinished count of id and reports whether id was
+// tracked.
+func (t *tap) track(id string, delta int) bool {
+	t.inflightMu.Lock()
+	defer t.inflightMu.Unlock()
+	if delta < 0 && t.inflight[id] == 0 {
+		return false
+	}
+	t.inflight[id] += delta
+	if t.inflight[id] == 0 {
+		delete(t.inflight, id)
+	}
+	return true
+}
+
+func (t *tap) pending() int {
+	t.inflightMu.Lock()
+	defer t.inflightMu.Unlock()
+	return len(t.inflight)
+}
+
+func (t *tap) write(line tapLine) {
+	line.TS = time.Now().UTC().Format(time.RFC3339Nano)
+	if line.SessionID == "" {
+		line.SessionID = t.sessionID
+	}
+	data, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	t.outMu.Lock()
+	defer t.outMu.Unlock()
+	fmt.Fprintf(t.out, "%s\n", data)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/shared/protocol"
+)
+
+// Exit codes of one-shot mode.
+const (
+	exitOK           = 0
+	exitError        = 1
+	exitUsage        = 2
+	exitOffline      = 3
+	exitTimeout      = 4
+	exitGatewayError = 5
+)
+
+// stringList collects a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+type oneShot struct {
+	relayURL        string
+	accessCode      string
+	caps            *protocol.Caps
+	responseTimeout time.Duration
+	mediaDir        string
+	output          string
+	record          *transcript
+}
+
+// oneShotResult is the -output json document.
+type oneShotResult struct {
+	OK        bool              `json:"ok"`
+	SessionID string            `json:"session_id,omitempty"`
+	Content   string            `json:"content"`
+	Meta      *protocol.RunMeta `json:"meta,omitempty"`
+	Error     *oneShotError     `json:"error,omitempty"`
+
+	// fromEvent marks errors that arrived as an error event rather than
+	// being detected locally.
+	fromEvent bool
+}
+
+type oneShotError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// stdinPiped reports whether stdin is a pipe or file rather than a terminal.
+func stdinPiped() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice == 0
+}
+
+// buildPrompt assembles the one-shot user_message from -prompt, -prompt-file
+// or piped stdin, plus -image files.
+func buildPrompt(prompt, promptFile string, imagePaths []string) (protocol.Event, error) {
+	event := protocol.Event{Type: protocol.EventUserMessage, Content: prompt}
+	switch {
+	case prompt != "" && promptFile != "":
+		return event, errors.New("-prompt and -prompt-file are mutually exclusive")
+	case promptFile != "":
+		raw, err := os.ReadFile(promptFile)
+		if err != nil {
+			return event, err
+		}
+		event.Content = string(raw)
+	case prompt == "":
+		raw, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return event, fmt.Errorf("read stdin: %w", err)
+		}
+		event.Content = string(raw)
+	}
+	event.Content = strings.TrimSpace(event.Content)
+
+	for _, path := range imagePaths {
+		image, err := loadImage(path)
+		if err != nil {
+			return event, err
+		}
+		event.Images = append(event.Images, image)
+	}
+	if event.Content == "" && len(event.Images) == 0 {
+		return event, errors.New("empty prompt")
+	}
+	return event, nil
+}
+
+// loadImage reads an image file as an inline image item.
+func loadImage(path string) (protocol.ImageItem, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return protocol.ImageItem{}, err
+	}
+	mimeType := http.DetectContentType(raw)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return protocol.ImageItem{}, fmt.Errorf("%s is not an image (%s)", path, mimeType)
+	}
+	return protocol.ImageItem{Data: base64.StdEncoding.EncodeToString(raw), MimeType: mimeType}, nil
+}
+
+// run sends event in a fresh session and waits for its end or error. It
+// returns the process exit code.
+func (o oneShot) run(event protocol.Event) int {
+	result := oneShotResult{}
+	view := renderState{mediaDir: o.mediaDir}
+
+	var content strings.Builder
+	code := o.exchange(event, &result, func(ev protocol.Event) {
+		if ev.Type == protocol.EventToken {
+			content.WriteString(ev.Content)
+		}
+		switch o.output {
+		case "ndjson":
+			line, _ := json.Marshal(ev)
+			fmt.Fprintf(os.Stdout, "%s\n", line)
+		case "json":
+		default:
+			if ev.Type != protocol.EventError {
+				view.render(os.Stdout, ev)
+			}
+		}
+	})
+
+	result.Content = content.String()
+	if result.SessionID != "" {
+		end := protocol.Event{Type: protocol.EventEnd, Meta: result.Meta}
+		if result.Error != nil {
+			end = protocol.Event{Type: protocol.EventError, Code: result.Error.Code, Message: result.Error.Message}
+		}
+		o.record.reply(result.SessionID, result.Content, end)
+	}
+
+	switch o.output {
+	case "json":
+		out, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintf(os.Stdout, "%s\n", out)
+	case "text":
+		if view.block != "" {
+			fmt.Fprintln(os.Stdout)
+		}
+		if result.Error != nil {
+			fmt.Fprintf(os.Stderr, "error: %s %s\n", result.Error.Code, result.Error.Message)
+		}
+	case "ndjson":
+		if result.Error != nil && !result.fromEvent {
+			line, _ := json.Marshal(protocol.Event{Type: protocol.EventError, Code: result.Error.Code, Message: result.Error.Message})
+			fmt.Fprintf(os.Stdout, "%s\n", line)
+		}
+	}
+	return code
+}
+
+func (o oneShot) exchange(event protocol.Event, result *oneShotResult, emit func(protocol.Event)) int {
+	fail := func(code int, errCode, message string) int {
+		result.Error = &oneShotError{Code: errCode, Message: message}
+		return code
+	}
+
+	sess, err := client.Dial(context.Background(), o.relayURL, o.accessCode, client.Options{Caps: o.caps})
+	if err != nil {
+		var connectErr *client.ConnectError
+		if errors.As(err, &connectErr) && connectErr.Code == "CONNECTOR_NOT_FOUND" {
+			return fail(exitOffline, connectErr.Code, connectErr.Message)
+		}
+		return fail(exitError, "CONNECT_FAILED", err.Error())
+	}
+	defer sess.Close()
+	result.SessionID = sess.ID()
+
+	if err := sess.Send(event); err != nil {
+		return fail(exitError, "SEND_FAILED", err.Error())
+	}
+	o.record.userMessage(result.SessionID, event)
+
+	for {
+		select {
+		case <-time.After(o.responseTimeout):
+			return fail(exitTimeout, "RESPONSE_TIMEOUT", fmt.Sprintf("no event within %s", o.responseTimeout))
+		case ev, ok := <-sess.Events():
+			if !ok {
+				return fail(exitError, "CONNECTION_LOST", fmt.Sprint(sess.Err()))
+			}
+			emit(ev)
+			switch ev.Type {
+			case protocol.EventEnd:
+				result.OK = true
+				result.Meta = ev.Meta
+				return exitOK
+			case protocol.EventError:
+				result.fromEvent = true
+				return fail(errorExitCode(ev.Code), ev.Code, ev.Message)
+			}
+		}
+	}
+}
+
+// errorExitCode classifies an error event from the connector.
+func errorExitCode(code string) int {
+	switch code {
+	case "CONNECTION_LOST":
+		return exitError
+	case "GATEWAY_NOT_READY", "GATEWAY_NOT_CONFIGURED", "GATEWAY_DISCONNECTED", "GATEWAY_QUEUE_TIMEOUT", "SESSION_NOT_OPEN":
+		return exitOffline
+	case "GATEWAY_TIMEOUT", "BACKEND_TIMEOUT":
+		return exitTimeout
+	default:
+		return exitGatewayError
+	}
+}
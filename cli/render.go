@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+const maxToolPreview = 200
+
+// parseEventCaps turns the -events flag into CONNECT caps. An empty list
+// keeps the default token/end/error stream.
+func parseEventCaps(list string) (*protocol.Caps, error) {
+	var events []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !protocol.IsOptionalEvent(name) {
+			return nil, fmt.Errorf("unknown optional event %q (allowed: %s)", name, strings.Join(protocol.OptionalEvents, ","))
+		}
+		events = append(events, name)
+	}
+	if len(events) == 0 {
+		return nil, nil
+	}
+	return &protocol.Caps{Events: events}, nil
+}
+
+// renderState tracks whether the terminal is mid-way through a streamed
+// reasoning or answer block, so labels are printed once per block.
+type renderState struct {
+	block    string
+	mediaDir string
+}
+
+func (r *renderState) render(w io.Writer, ev protocol.Event) {
+	switch ev.Type {
+	case protocol.EventToken:
+		r.enter(w, protocol.EventToken, "")
+		fmt.Fprint(w, ev.Content)
+	case protocol.EventReasoning:
+		r.enter(w, protocol.EventReasoning, "[reasoning] ")
+		fmt.Fprint(w, ev.Content)
+	case protocol.EventToolCall:
+		r.enter(w, "", "")
+		fmt.Fprintf(w, "[tool_call] %s %s\n", toolName(ev.Tool), preview(toolArgs(ev.Tool)))
+	case protocol.EventToolResult:
+		r.enter(w, "", "")
+		label := "[tool_result]"
+		if ev.Tool != nil && ev.Tool.IsError {
+			label = "[tool_error]"
+		}
+		fmt.Fprintf(w, "%s %s %s\n", label, toolName(ev.Tool), preview(toolResult(ev.Tool)))
+	case protocol.EventStatus:
+		r.enter(w, "", "")
+		if ev.Message != "" {
+			fmt.Fprintf(w, "[status] %s %s\n", ev.Status, ev.Message)
+		} else {
+			fmt.Fprintf(w, "[status] %s\n", ev.Status)
+		}
+	case protocol.EventMedia:
+		r.enter(w, "", "")
+		r.renderMedia(w, ev.Media)
+	case protocol.EventEnd:
+		r.enter(w, "", "")
+	case protocol.EventError:
+		r.enter(w, "", "")
+		fmt.Fprintf(w, "error: %s %s\n", ev.Code, ev.Message)
+	}
+}
+
+// enter switches to block, terminating the current streamed line first.
+func (r *renderState) enter(w io.Writer, block, label string) {
+	if r.block == block && block != "" {
+		return
+	}
+	if r.block != "" {
+		fmt.Fprintln(w)
+	}
+	r.block = block
+	fmt.Fprint(w, label)
+}
+
+func (r *renderState) renderMedia(w io.Writer, media *protocol.MediaInfo) {
+	if media == nil {
+		return
+	}
+	if media.URL != "" {
+		fmt.Fprintf(w, "[media] %s %s\n", media.MimeType, media.URL)
+		return
+	}
+	path, err := saveMedia(r.mediaDir, media)
+	if err != nil {
+		fmt.Fprintf(w, "[media] %s %d bytes not saved: %v\n", media.MimeType, media.Size, err)
+		return
+	}
+	fmt.Fprintf(w, "[media] %s %d bytes saved to %s\n", media.MimeType, media.Size, path)
+}
+
+func toolName(t *protocol.ToolInfo) string {
+	if t == nil || t.Name == "" {
+		return "?"
+	}
+	return t.Name
+}
+
+func toolArgs(t *protocol.ToolInfo) string {
+	if t == nil {
+		return ""
+	}
+	return string(t.Args)
+}
+
+func toolResult(t *protocol.ToolInfo) string {
+	if t == nil {
+		return ""
+	}
+	return string(t.Result)
+}
+
+func preview(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) > maxToolPreview {
+		return s[:maxToolPreview] + "..."
+	}
+	return s
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/shared/protocol"
+)
+
+// runServe implements `openclaw-cli serve`: a local OpenAI-compatible HTTP
+// server that answers every chat completion through a fresh relay session.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8787", "local http listen address")
+	relayURL := fs.String("relay-url", "ws://127.0.0.1:8080/client", "relay client websocket url")
+	accessCode := fs.String("access-code", "", "access code")
+	apiKey := fs.String("api-key", "", "bearer token local clients must send (empty disables the check)")
+	model := fs.String("model", "openclaw", "model name reported to clients")
+	responseTimeout := fs.Duration("response-timeout", 5*time.Minute, "max wait between events before failing a request")
+	_ = fs.Parse(args)
+
+	if strings.TrimSpace(*accessCode) == "" {
+		log.Fatal("-access-code is required")
+	}
+
+	p := &proxy{
+		relayURL:        *relayURL,
+		accessCode:      *accessCode,
+		apiKey:          *apiKey,
+		model:           *model,
+		responseTimeout: *responseTimeout,
+		logger:          log.New(os.Stderr, "[serve] ", log.LstdFlags),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", p.handleChatCompletions)
+	mux.HandleFunc("/v1/models", p.handleModels)
+
+	p.logger.Printf("listening addr=%s relay_url=%s", *listen, *relayURL)
+	if err := http.ListenAndServe(*listen, mux); err != nil {
+		log.Fatal(err)
+	}
+}
+
+type proxy struct {
+	relayURL        string
+	accessCode      string
+	apiKey          string
+	model           string
+	responseTimeout time.Duration
+	logger          *log.Logger
+}
+
+type chatCompletionRequest struct {
+	Model         string        `json:"model"`
+	Messages      []chatMessage `json:"messages"`
+	Stream        bool          `json:"stream"`
+	StreamOptions *struct {
+		IncludeUsage bool `json:"include_usage"`
+	} `json:"stream_options"`
+}
+
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type contentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+type chatUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+func (p *proxy) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeAPIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "use GET")
+		return
+	}
+	if !p.authorized(w, r) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"object": "list",
+		"data":   []map[string]any{{"id": p.model, "object": "model", "owned_by": "openclaw"}},
+	})
+}
+
+func (p *proxy) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeAPIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "use POST")
+		return
+	}
+	if !p.authorized(w, r) {
+		return
+	}
+	var req chatCompletionRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<20)).Decode(&req); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", "invalid json body: "+err.Error())
+		return
+	}
+	event, err := userMessageFromChat(req.Messages)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	model := req.Model
+	if model == "" {
+		model = p.model
+	}
+
+	sess, err := client.Dial(r.Context(), p.relayURL, p.accessCode, client.Options{})
+	if err != nil {
+		writeAPIError(w, http.StatusBadGateway, "relay_error", err.Error())
+		return
+	}
+	defer sess.Close()
+	if err := sess.SendContext(r.Context(), event); err != nil {
+		writeAPIError(w, http.StatusBadGateway, "relay_error", err.Error())
+		return
+	}
+
+	completion := &completionStream{
+		id:      "chatcmpl-" + randomHex(12),
+		model:   model,
+		created: time.Now().Unix(),
+	}
+	if req.Stream {
+		completion.sse = w
+		completion.includeUsage = req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			_ = sess.Stop("")
+			p.logger.Printf("client went away sid=%s", sess.ID())
+			return
+		case <-time.After(p.responseTimeout):
+			completion.fail(w, http.StatusGatewayTimeout, "timeout", fmt.Sprintf("no event within %s", p.responseTimeout))
+			return
+		case ev, ok := <-sess.Events():
+			if !ok {
+				completion.fail(w, http.StatusBadGateway, "relay_error", fmt.Sprint(sess.Err()))
+				return
+			}
+			switch ev.Type {
+			case protocol.EventToken:
+				completion.token(ev.Content)
+			case protocol.EventError:
+				completion.fail(w, http.StatusBadGateway, ev.Code, ev.Message)
+				return
+			case protocol.EventEnd:
+				completion.finish(w, ev.Meta)
+				return
+			}
+		}
+	}
+}
+
+func (p *proxy) authorized(w http.ResponseWriter, r *http.Request) bool {
+	if p.apiKey == "" || r.Header.Get("Authorization") == "Bearer "+p.apiKey {
+		return true
+	}
+	writeAPIError(w, http.StatusUnauthorized, "invalid_api_key", "invalid api key")
+	return false
+}
+
+// userMessageFromChat turns an OpenAI message list into one user_message.
+// Every request runs in a new relay session, so earlier turns are replayed
+// as a transcript ahead of the last user message.
+func userMessageFromChat(messages []chatMessage) (protocol.Event, error) {
+	last := -1
+	for i, msg := range messages {
+		if msg.Role == "user" {
+			last = i
+		}
+	}
+	if last < 0 {
+		return protocol.Event{}, errors.New("messages must contain a user message")
+	}
+
+	var transcript strings.Builder
+	for _, msg := range messages[:last] {
+		text, _, err := messageContent(msg.Content)
+		if err != nil {
+			return protocol.Event{}, err
+		}
+		fmt.Fprintf(&transcript, "[%s]\n%s\n\n", msg.Role, text)
+	}
+	text, images, err := messageContent(messages[last].Content)
+	if err != nil {
+		return protocol.Event{}, err
+	}
+	if transcript.Len() > 0 {
+		text = transcript.String() + "[user]\n" + text
+	}
+	return protocol.Event{Type: protocol.EventUserMessage, Content: text, Images: images}, nil
+}
+
+// messageContent accepts both string content and content-part arrays.
+// Images must be data URLs.
+func messageContent(raw json.RawMessage) (string, []protocol.ImageItem, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil, nil
+	}
+	var parts []contentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", nil, errors.New("message content must be a string or an array of parts")
+	}
+	var texts []string
+	var images []protocol.ImageItem
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			texts = append(texts, part.Text)
+		case "image_url":
+			url := part.ImageURL.URL
+			header, data, ok := strings.Cut(strings.TrimPrefix(url, "data:"), ";base64,")
+			if !strings.HasPrefix(url, "data:") || !ok {
+				return "", nil, errors.New("image_url must be a base64 data URL")
+			}
+			images = append(images, protocol.ImageItem{Data: data, MimeType: header})
+		default:
+			return "", nil, fmt.Errorf("unsupported content part %q", part.Type)
+		}
+	}
+	return strings.Join(texts, "\n"), images, nil
+}
+
+// completionStream renders relay events as a chat completion, either as SSE
+// chunks (sse set) or as one JSON body when the run ends.
+type completionStream struct {
+	id           string
+	model        string
+	created      int64
+	sse          http.ResponseWriter
+	includeUsage bool
+	started      bool
+	content      strings.Builder
+}
+
+func (c *completionStream) token(text string) {
+	if c.sse == nil {
+		c.content.WriteString(text)
+		return
+	}
+	delta := map[string]any{"content": text}
+	if !c.started {
+		c.start()
+		delta["role"] = "assistant"
+	}
+	c.chunk([]map[string]any{{"index": 0, "delta": delta, "finish_reason": nil}}, nil)
+}
+
+func (c *completionStream) finish(w http.ResponseWriter, meta *protocol.RunMeta) {
+	reason := finishReason(meta)
+	usage := usageOf(meta)
+	if c.sse == nil {
+		body := map[string]any{
+			"id":      c.id,
+			"object":  "chat.completion",
+			"created": c.created,
+			"model":   c.model,
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       map[string]any{"role": "assistant", "content": c.content.String()},
+				"finish_reason": reason,
+			}},
+		}
+		if usage != nil {
+			body["usage"] = usage
+		}
+		writeJSON(w, http.StatusOK, body)
+		return
+	}
+	if !c.started {
+		c.start()
+	}
+	c.chunk([]map[string]any{{"index": 0, "delta": map[string]any{}, "finish_reason": reason}}, nil)
+	if c.includeUsage {
+		if usage == nil {
+			usage = &chatUsage{}
+		}
+		c.chunk([]map[string]any{}, usage)
+	}
+	c.write("[DONE]")
+}
+
+// fail reports an error as an HTTP error before the stream started, or as a
+// final error chunk after it.
+func (c *completionStream) fail(w http.ResponseWriter, status int, code, message string) {
+	if !c.started {
+		writeAPIError(w, status, code, message)
+		return
+	}
+	payload, _ := json.Marshal(map[string]any{"error": map[string]any{"message": message, "type": "server_error", "code": code}})
+	c.write(string(payload))
+	c.write("[DONE]")
+}
+
+func (c *completionStream) start() {
+	c.started = true
+	h := c.sse.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	c.sse.WriteHeader(http.StatusOK)
+}
+
+func (c *completionStream) chunk(choices []map[string]any, usage *chatUsage) {
+	body := map[string]any{
+		"id":      c.id,
+		"object":  "chat.completion.chunk",
+		"created": c.created,
+		"model":   c.model,
+		"choices": choices,
+	}
+	if usage != nil {
+		body["usage"] = usage
+	}
+	payload, _ := json.Marshal(body)
+	c.write(string(payload))
+}
+
+func (c *completionStream) write(data string) {
+	fmt.Fprintf(c.sse, "data: %s\n\n", data)
+	if f, ok := c.sse.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finishReason maps the run stop reason onto the OpenAI vocabulary.
+func finishReason(meta *protocol.RunMeta) string {
+	if meta == nil {
+		return "stop"
+	}
+	switch meta.StopReason {
+	case "length", "max_tokens":
+		return "length"
+	case "content_filter", "tool_calls":
+		return meta.StopReason
+	default:
+		return "stop"
+	}
+}
+
+func usageOf(meta *protocol.RunMeta) *chatUsage {
+	if meta == nil || meta.Usage == nil {
+		return nil
+	}
+	u := meta.Usage
+	total := u.TotalTokens
+	if total == 0 {
+		total = u.InputTokens + u.OutputTokens
+	}
+	return &chatUsage{PromptTokens: u.InputTokens, CompletionTokens: u.OutputTokens, TotalTokens: total}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	errType := "invalid_request_error"
+	if status >= 500 {
+		errType = "server_error"
+	}
+	writeJSON(w, status, map[string]any{"error": map[string]any{"message": message, "type": errType, "code": code}})
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+const (
+	transcriptMarkdown = "markdown"
+	transcriptJSONL    = "jsonl"
+)
+
+// transcriptEntry is one user message or assembled assistant reply. It is
+// also the line format of JSONL transcripts.
+type transcriptEntry struct {
+	Time      time.Time         `json:"ts"`
+	SessionID string            `json:"session_id"`
+	Role      string            `json:"role"`
+	ID        string            `json:"id,omitempty"`
+	Content   string            `json:"content"`
+	Images    int               `json:"images,omitempty"`
+	Meta      *protocol.RunMeta `json:"meta,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// transcript keeps the conversation in memory and, when a path is set,
+// appends every entry to it as it happens.
+type transcript struct {
+	format  string
+	file    *os.File
+	entries []transcriptEntry
+}
+
+// transcriptFormat picks the explicit format, or infers it from the file
+// extension.
+func transcriptFormat(path, explicit string) (string, error) {
+	switch explicit {
+	case transcriptMarkdown, transcriptJSONL:
+		return explicit, nil
+	case "":
+	default:
+		return "", fmt.Errorf("transcript format must be %s or %s", transcriptMarkdown, transcriptJSONL)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return transcriptJSONL, nil
+	}
+	return transcriptMarkdown, nil
+}
+
+// openTranscript appends to path, or keeps the transcript in memory only when
+// path is empty.
+func openTranscript(path, format string) (*transcript, error) {
+	t := &transcript{format: format}
+	if path == "" {
+		return t, nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	t.file = f
+	if info, err := f.Stat(); err == nil && info.Size() == 0 && format == transcriptMarkdown {
+		fmt.Fprint(f, "# OpenClaw transcript\n")
+	}
+	return t, nil
+}
+
+func (t *transcript) userMessage(sessionID string, event protocol.Event) {
+	t.record(transcriptEntry{
+		SessionID: sessionID,
+		Role:      "user",
+		ID:        event.ID,
+		Content:   event.Content,
+		Images:    len(event.Images),
+	})
+}
+
+// reply records the assembled reply finished by end, an end or error event.
+func (t *transcript) reply(sessionID, content string, end protocol.Event) {
+	entry := transcriptEntry{SessionID: sessionID, Role: "assistant", ID: end.ID, Content: content, Meta: end.Meta}
+	if end.Type == protocol.EventError {
+		entry.Error = end.Code + ": " + end.Message
+	}
+	t.record(entry)
+}
+
+func (t *transcript) record(entry transcriptEntry) {
+	entry.Time = time.Now()
+	t.entries = append(t.entries, entry)
+	if t.file != nil {
+		_ = writeTranscriptEntry(t.file, t.format, entry)
+	}
+}
+
+// export writes the whole conversation to path, in the format its extension
+// names.
+func (t *transcript) export(path string) error {
+	format, _ := transcriptFormat(path, "")
+	var b strings.Builder
+	if format == transcriptMarkdown {
+		b.WriteString("# OpenClaw transcript\n")
+	}
+	for _, entry := range t.entries {
+		if err := writeTranscriptEntry(&b, format, entry); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o600)
+}
+
+func (t *transcript) close() {
+	if t.file != nil {
+		_ = t.file.Close()
+	}
+}
+
+func writeTranscriptEntry(w io.Writer, format string, entry transcriptEntry) error {
+	if format == transcriptJSONL {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", line)
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n## %s · %s · %s\n\n", entry.Role, entry.Time.Format(time.RFC3339), entry.SessionID)
+	if entry.Content != "" {
+		b.WriteString(strings.TrimRight(entry.Content, "\n") + "\n")
+	}
+	if entry.Images > 0 {
+		fmt.Fprintf(&b, "\n_%d image(s) attached_\n", entry.Images)
+	}
+	if entry.Error != "" {
+		fmt.Fprintf(&b, "\n> error: %s\n", entry.Error)
+	}
+	if summary := metaSummary(entry.Meta); summary != "" {
+		fmt.Fprintf(&b, "\n_%s_\n", summary)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func metaSummary(meta *protocol.RunMeta) string {
+	if meta == nil {
+		return ""
+	}
+	var parts []string
+	if meta.Model != "" {
+		parts = append(parts, "model "+meta.Model)
+	}
+	if meta.StopReason != "" {
+		parts = append(parts, "stop "+meta.StopReason)
+	}
+	if u := meta.Usage; u != nil {
+		parts = append(parts, fmt.Sprintf("tokens %d in / %d out", u.InputTokens, u.OutputTokens))
+	}
+	if meta.DurationMs > 0 {
+		parts = append(parts, fmt.Sprintf("%d ms", meta.DurationMs))
+	}
+	if meta.RunID != "" {
+		parts = append(parts, "run "+meta.RunID)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// resumeTranscript prints a previous conversation to w and loads it into t,
+// so later exports contain the whole conversation. Markdown transcripts are
+// printed as they are.
+func resumeTranscript(w io.Writer, path string, t *transcript) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if format, _ := transcriptFormat(path, ""); format == transcriptMarkdown {
+		fmt.Fprintf(w, "%s\n", strings.TrimRight(string(raw), "\n"))
+		t.entries = append(parseMarkdownTranscript(string(raw)), t.entries...)
+		return nil
+	}
+
+	var loaded []transcriptEntry
+	scanner := bufio.NewScanner(strings.NewReader(string(raw)))
+	scanner.Buffer(make([]byte, 64<<10), 32<<20)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry transcriptEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		loaded = append(loaded, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, entry := range loaded {
+		label := "you"
+		if entry.Role == "assistant" {
+			label = "assistant"
+		}
+		fmt.Fprintf(w, "[%s %s] %s\n", entry.Time.Local().Format("2006-01-02 15:04"), label, strings.TrimRight(entry.Content, "\n"))
+		if entry.Error != "" {
+			fmt.Fprintf(w, "error: %s\n", entry.Error)
+		}
+	}
+	t.entries = append(loaded, t.entries...)
+	return nil
+}
+
+// parseMarkdownTranscript reverses writeTranscriptEntry for markdown. Run
+// metadata is recovered from its summary line; content lines that look like
+// entry headings end up splitting the entry.
+func parseMarkdownTranscript(raw string) []transcriptEntry {
+	var entries []transcriptEntry
+	var body []string
+	var current *transcriptEntry
+	flush := func() {
+		if current != nil {
+			fillMarkdownBody(current, body)
+			entries = append(entries, *current)
+		}
+		current, body = nil, nil
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		if heading, ok := strings.CutPrefix(line, "## "); ok {
+			if parts := strings.Split(heading, " · "); len(parts) == 3 {
+				flush()
+				ts, _ := time.Parse(time.RFC3339, parts[1])
+				current = &transcriptEntry{Role: parts[0], Time: ts, SessionID: parts[2]}
+				continue
+			}
+		}
+		if current != nil {
+			body = append(body, line)
+		}
+	}
+	flush()
+	return entries
+}
+
+// fillMarkdownBody peels the image, error and metadata lines off the end of
+// an entry body; the rest is its content.
+func fillMarkdownBody(entry *transcriptEntry, lines []string) {
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	// Each trailer is written as its own paragraph, in this order.
+	trailer := func(parse func(string) bool) {
+		n := len(lines)
+		if n == 0 || (n > 1 && lines[n-2] != "") || !parse(lines[n-1]) {
+			return
+		}
+		lines = lines[:max(n-2, 0)]
+	}
+	trailer(func(line string) bool {
+		entry.Meta = parseMetaSummary(line)
+		return entry.Meta != nil
+	})
+	trailer(func(line string) bool {
+		msg, ok := strings.CutPrefix(line, "> error: ")
+		if ok {
+			entry.Error = msg
+		}
+		return ok
+	})
+	trailer(func(line string) bool {
+		_, err := fmt.Sscanf(line, "_%d image(s) attached_", &entry.Images)
+		return err == nil
+	})
+	entry.Content = strings.Join(lines, "\n")
+}
+
+// parseMetaSummary reverses metaSummary, returning nil for lines that are
+// not a summary.
+func parseMetaSummary(line string) *protocol.RunMeta {
+	if len(line) < 3 || line[0] != '_' || line[len(line)-1] != '_' {
+		return nil
+	}
+	inner := line[1 : len(line)-1]
+	meta := &protocol.RunMeta{}
+	for _, part := range strings.Split(inner, " · ") {
+		key, value, _ := strings.Cut(part, " ")
+		switch key {
+		case "model":
+			meta.Model = value
+		case "stop":
+			meta.StopReason = value
+		case "tokens":
+			meta.Usage = &protocol.Usage{}
+			if _, err := fmt.Sscanf(value, "%d in / %d out", &meta.Usage.InputTokens, &meta.Usage.OutputTokens); err != nil {
+				return nil
+			}
+		case "run":
+			meta.RunID = value
+		default:
+			if _, err := fmt.Sscanf(part, "%d ms", &meta.DurationMs); err != nil {
+				return nil
+			}
+		}
+	}
+	return meta
+}
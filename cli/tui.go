@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/shared/protocol"
+)
+
+const tuiHelp = `commands:
+  /stop            stop the streaming reply
+  /image <path>    attach an image to the next message
+  /reconnect       open a new session
+  /raw             toggle raw JSON event display
+  /raw <json>      send a raw event
+  /save [path]     save the conversation (.md, or .jsonl for JSONL)
+  /quit            close the session and exit
+keys: Enter sends, a trailing \ or Alt+Enter continues on a new line,
+      Up/Down browse history, Ctrl+C stops a reply or exits`
+
+type tuiOptions struct {
+	relayURL        string
+	accessCode      string
+	caps            *protocol.Caps
+	responseTimeout time.Duration
+	reconnectDelay  time.Duration
+	mediaDir        string
+	historyPath     string
+	record          *transcript
+	// resumed is a previous conversation printed when the screen opens.
+	resumed string
+}
+
+// terminal is the screen the TUI draws on: an output region scrolling above
+// a status bar and an input line.
+type terminal struct {
+	rows, cols  int
+	restoreMode func()
+}
+
+type tui struct {
+	opts tuiOptions
+	term *terminal
+	out  *bufio.Writer
+
+	sess        *client.Session
+	sessionID   string
+	events      <-chan protocol.Event
+	state       string
+	reconnected chan *client.Session
+	quit        chan struct{}
+
+	editor      lineEditor
+	view        renderState
+	md          markdownRenderer
+	partial     string
+	atLineStart bool
+
+	streaming   bool
+	stopping    bool
+	currentID   string
+	lastEventAt time.Time
+	reply       strings.Builder
+
+	raw    bool
+	images []protocol.ImageItem
+}
+
+// runTUI runs the full-screen interactive client and returns the process
+// exit code.
+func runTUI(opts tuiOptions) int {
+	term, err := openTerminal()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return exitUsage
+	}
+
+	t := &tui{
+		opts:        opts,
+		term:        term,
+		out:         bufio.NewWriter(os.Stdout),
+		reconnected: make(chan *client.Session),
+		quit:        make(chan struct{}),
+		view:        renderState{mediaDir: opts.mediaDir},
+		atLineStart: true,
+	}
+	t.editor.history = loadHistory(opts.historyPath)
+	t.editor.histPos = len(t.editor.history)
+
+	sess, err := t.dial()
+	if err != nil {
+		term.restoreMode()
+		fmt.Fprintf(os.Stderr, "connect failed: %v\n", err)
+		var connectErr *client.ConnectError
+		if errors.As(err, &connectErr) && connectErr.Code == "CONNECTOR_NOT_FOUND" {
+			return exitOffline
+		}
+		return exitError
+	}
+	defer t.close()
+	t.attach(sess)
+	t.setupScreen()
+	if opts.resumed != "" {
+		t.notice(strings.TrimRight(opts.resumed, "\n"))
+	}
+	t.notice(fmt.Sprintf("connected session=%s, /help lists commands", t.sessionID))
+
+	keys := make(chan []key)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 4096)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if n > 0 {
+				keys <- decodeKeys(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case batch, ok := <-keys:
+			if !ok {
+				return exitOK
+			}
+			for _, k := range batch {
+				if t.handleKey(k) {
+					return exitOK
+				}
+			}
+			t.drawChrome()
+		case ev, ok := <-t.events:
+			if !ok {
+				t.connectionLost(t.sess.Err())
+				break
+			}
+			t.handleEvent(ev)
+		case sess := <-t.reconnected:
+			t.attach(sess)
+			t.notice(fmt.Sprintf("reconnected session=%s", t.sessionID))
+		case <-resize:
+			t.term.rows, t.term.cols = terminalSize()
+			t.setupScreen()
+		case <-ticker.C:
+			if t.streaming && time.Since(t.lastEventAt) > t.opts.responseTimeout {
+				message := fmt.Sprintf("no terminal event within %s", t.opts.responseTimeout)
+				t.abandonReply("RESPONSE_TIMEOUT", message)
+				t.notice("error: RESPONSE_TIMEOUT " + message)
+			}
+		}
+	}
+}
+
+// dial opens a session; the TUI reconnects on its own so it can show
+// progress in the status bar.
+func (t *tui) dial() (*client.Session, error) {
+	return client.Dial(context.Background(), t.opts.relayURL, t.opts.accessCode, client.Options{Caps: t.opts.caps})
+}
+
+func (t *tui) attach(sess *client.Session) {
+	t.sess, t.sessionID = sess, sess.ID()
+	t.events = sess.Events()
+	t.state = "connected"
+}
+
+func (t *tui) close() {
+	close(t.quit)
+	if t.sess != nil {
+		_ = t.sess.Close()
+	}
+	if t.opts.historyPath != "" {
+		_ = saveHistory(t.opts.historyPath, t.editor.history)
+	}
+	fmt.Fprintf(t.out, "\x1b[r\x1b[%d;1H\x1b[2K\n", t.term.rows)
+	t.out.Flush()
+	t.term.restoreMode()
+}
+
+func (t *tui) handleKey(k key) (quit bool) {
+	switch k.code {
+	case keyCtrlC:
+		if t.streaming {
+			if t.stopping {
+				return true
+			}
+			t.stop()
+			return false
+		}
+		if !t.editor.empty() {
+			t.editor.clear()
+			return false
+		}
+		return true
+	case keyCtrlD:
+		return t.editor.empty()
+	case keyCtrlL:
+		t.setupScreen()
+		return false
+	}
+
+	message, submitted := t.editor.handle(k)
+	if !submitted || strings.TrimSpace(message) == "" {
+		return false
+	}
+	t.editor.remember(message)
+	return t.submit(message)
+}
+
+func (t *tui) submit(message string) (quit bool) {
+	text := strings.TrimSpace(message)
+	if strings.HasPrefix(text, "/") {
+		return t.command(text)
+	}
+	if strings.HasPrefix(text, "json:") {
+		t.sendRaw(strings.TrimPrefix(text, "json:"))
+		return false
+	}
+	t.send(protocol.Event{Type: protocol.EventUserMessage, Content: message})
+	return false
+}
+
+func (t *tui) command(text string) (quit bool) {
+	name, arg, _ := strings.Cut(text, " ")
+	arg = strings.TrimSpace(arg)
+	switch name {
+	case "/help":
+		t.notice(tuiHelp)
+	case "/quit", "/exit":
+		return true
+	case "/stop":
+		if !t.streaming {
+			t.notice("nothing to stop")
+			break
+		}
+		t.stop()
+	case "/image":
+		if arg == "" {
+			t.notice("usage: /image <path>")
+			break
+		}
+		image, err := loadImage(arg)
+		if err != nil {
+			t.notice("error: " + err.Error())
+			break
+		}
+		t.images = append(t.images, image)
+		t.notice(fmt.Sprintf("attached %s (%s), sent with the next message", arg, image.MimeType))
+	case "/reconnect":
+		t.reconnect()
+	case "/raw":
+		if arg != "" {
+			t.sendRaw(arg)
+			break
+		}
+		t.raw = !t.raw
+		t.notice(fmt.Sprintf("raw event display %s", map[bool]string{true: "on", false: "off"}[t.raw]))
+	case "/save":
+		path := arg
+		if path == "" {
+			path = "openclaw-" + time.Now().Format("20060102-150405") + ".md"
+		}
+		if err := t.opts.record.export(path); err != nil {
+			t.notice("error: " + err.Error())
+			break
+		}
+		t.notice("saved " + path)
+	default:
+		t.notice(fmt.Sprintf("unknown command %s, /help lists commands", name))
+	}
+	return false
+}
+
+func (t *tui) sendRaw(raw string) {
+	event := protocol.Event{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(raw)), &event); err != nil {
+		t.notice("error: invalid json event: " + err.Error())
+		return
+	}
+	if event.Type == "" {
+		event.Type = protocol.EventUserMessage
+	}
+	t.send(event)
+}
+
+func (t *tui) send(event protocol.Event) {
+	if t.sess == nil {
+		t.notice("not connected")
+		return
+	}
+	isMessage := event.Type == protocol.EventUserMessage
+	if isMessage {
+		if t.streaming {
+			t.notice("a reply is still streaming, /stop it first")
+			return
+		}
+		event.Images = append(event.Images, t.images...)
+	}
+	if err := t.sess.Send(event); err != nil {
+		t.notice("error: send failed: " + err.Error())
+		return
+	}
+	if !isMessage {
+		return
+	}
+
+	t.images = nil
+	t.streaming, t.stopping = true, false
+	t.currentID = event.ID
+	t.lastEventAt = time.Now()
+	t.reply.Reset()
+	t.opts.record.userMessage(t.sessionID, event)
+
+	var b strings.Builder
+	for _, line := range strings.Split(event.Content, "\n") {
+		b.WriteString(ansiDim + "> " + line + ansiReset + "\n")
+	}
+	if n := len(event.Images); n > 0 {
+		fmt.Fprintf(&b, "%s> [%d image(s)]%s\n", ansiDim, n, ansiReset)
+	}
+	t.emit(b.String())
+}
+
+func (t *tui) stop() {
+	t.stopping = true
+	if t.sess == nil {
+		return
+	}
+	if err := t.sess.Stop(t.currentID); err != nil {
+		t.notice("error: send stop: " + err.Error())
+		return
+	}
+	t.notice("[stopping] press Ctrl+C again to exit")
+}
+
+func (t *tui) handleEvent(ev protocol.Event) {
+	t.lastEventAt = time.Now()
+	switch {
+	case t.raw:
+		t.flushPartial()
+		line, _ := json.Marshal(ev)
+		t.emit(ansiDim + string(line) + ansiReset + "\n")
+		if ev.Type == protocol.EventToken {
+			t.reply.WriteString(ev.Content)
+		}
+	case ev.Type == protocol.EventToken:
+		if t.view.block != "" {
+			t.emit("\n")
+			t.view.block = ""
+		}
+		t.reply.WriteString(ev.Content)
+		t.streamText(ev.Content)
+	default:
+		t.flushPartial()
+		var b strings.Builder
+		t.view.render(&b, ev)
+		t.emit(b.String())
+	}
+
+	if ev.Type == protocol.EventEnd || ev.Type == protocol.EventError {
+		t.flushPartial()
+		if t.streaming {
+			t.opts.record.reply(t.sessionID, t.reply.String(), ev)
+		}
+		t.streaming, t.stopping = false, false
+		t.md = markdownRenderer{}
+		t.drawChrome()
+	}
+}
+
+func (t *tui) connectionLost(err error) {
+	t.flushPartial()
+	t.notice(fmt.Sprintf("connection lost: %v", err))
+	if t.streaming {
+		t.abandonReply("CONNECTION_LOST", err.Error())
+		t.notice("request interrupted, please resend your message")
+	}
+	t.reconnect()
+}
+
+// abandonReply records the partial reply of a run that will not finish.
+func (t *tui) abandonReply(code, message string) {
+	if !t.streaming {
+		return
+	}
+	t.flushPartial()
+	t.opts.record.reply(t.sessionID, t.reply.String(), protocol.Event{Type: protocol.EventError, ID: t.currentID, Code: code, Message: message})
+	t.streaming, t.stopping = false, false
+}
+
+// reconnect replaces the session in the background; the status bar shows
+// progress and the main loop picks up the new session.
+func (t *tui) reconnect() {
+	if t.sess != nil {
+		_ = t.sess.Close()
+	}
+	t.abandonReply("CONNECTION_LOST", "session replaced")
+	t.sess, t.events = nil, nil
+	t.state = "reconnecting"
+	t.drawChrome()
+
+	go func() {
+		for {
+			sess, err := t.dial()
+			if err == nil {
+				select {
+				case t.reconnected <- sess:
+				case <-t.quit:
+					_ = sess.Close()
+				}
+				return
+			}
+			select {
+			case <-t.quit:
+				return
+			case <-time.After(t.opts.reconnectDelay):
+			}
+		}
+	}()
+}
+
+// streamText writes reply text as it arrives and restyles each line as
+// markdown once it is complete.
+func (t *tui) streamText(s string) {
+	for s != "" {
+		i := strings.IndexByte(s, '\n')
+		if i < 0 {
+			t.partial += s
+			t.emit(s)
+			return
+		}
+		t.partial += s[:i]
+		t.emit(s[:i] + t.restyle() + "\n")
+		s = s[i+1:]
+	}
+}
+
+// restyle returns the sequence replacing the raw partial line with its
+// markdown rendering. Lines that wrapped are left raw.
+func (t *tui) restyle() string {
+	line := t.partial
+	t.partial = ""
+	rendered := t.md.line(line)
+	if utf8.RuneCountInString(line) >= t.term.cols {
+		return ""
+	}
+	return "\r\x1b[K" + rendered
+}
+
+func (t *tui) flushPartial() {
+	if t.partial != "" {
+		t.emit(t.restyle() + "\n")
+	}
+}
+
+// notice prints a line of client output on its own line.
+func (t *tui) notice(text string) {
+	if !t.atLineStart {
+		text = "\n" + text
+	}
+	t.emit(text + "\n")
+}
+
+func (t *tui) setupScreen() {
+	fmt.Fprintf(t.out, "\x1b[H\x1b[2J\x1b[1;%dr\x1b[1;1H\x1b7", t.term.rows-2)
+	t.atLineStart = true
+	t.drawChrome()
+}
+
+// emit writes s at the saved output cursor inside the scroll region, then
+// returns to the input line.
+func (t *tui) emit(s string) {
+	if s == "" {
+		return
+	}
+	t.out.WriteString("\x1b8")
+	t.out.WriteString(s)
+	t.out.WriteString("\x1b7")
+	t.atLineStart = strings.HasSuffix(s, "\n")
+	t.drawChrome()
+}
+
+func (t *tui) drawChrome() {
+	rows, cols := t.term.rows, t.term.cols
+
+	status := fmt.Sprintf(" %s │ session=%s", t.state, t.sessionID)
+	if t.streaming {
+		status += " │ streaming"
+	}
+	if n := len(t.images); n > 0 {
+		status += fmt.Sprintf(" │ %d image(s) attached", n)
+	}
+	if t.raw {
+		status += " │ raw"
+	}
+	fmt.Fprintf(t.out, "\x1b[%d;1H\x1b[2K\x1b[7m%s\x1b[0m", rows-1, fitWidth(status, cols))
+
+	prompt := "> "
+	if n := len(t.editor.lines); n > 0 {
+		prompt = fmt.Sprintf("[%d] ", n+1)
+	}
+	line := []rune(strings.ReplaceAll(string(t.editor.buf), "\n", "↵"))
+	avail := max(cols-utf8.RuneCountInString(prompt)-1, 1)
+	start := max(t.editor.pos-avail, 0)
+	end := min(len(line), start+avail)
+	fmt.Fprintf(t.out, "\x1b[%d;1H\x1b[2K%s%s", rows, prompt, string(line[start:end]))
+	fmt.Fprintf(t.out, "\x1b[%d;%dH", rows, utf8.RuneCountInString(prompt)+t.editor.pos-start+1)
+	t.out.Flush()
+}
+
+// fitWidth pads or truncates s to exactly width runes.
+func fitWidth(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s + strings.Repeat(" ", width-len(r))
+}
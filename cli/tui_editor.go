@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxHistory bounds the persistent TUI history file.
+const maxHistory = 1000
+
+type keyCode int
+
+const (
+	keyRune keyCode = iota
+	keyEnter
+	keyAltEnter
+	keyBackspace
+	keyDelete
+	keyLeft
+	keyRight
+	keyUp
+	keyDown
+	keyHome
+	keyEnd
+	keyCtrlC
+	keyCtrlD
+	keyCtrlU
+	keyCtrlK
+	keyCtrlW
+	keyCtrlL
+	keyUnknown
+)
+
+type key struct {
+	code keyCode
+	r    rune
+}
+
+// decodeKeys turns raw terminal input into keys. Escape sequences split
+// across reads decode as keyUnknown.
+func decodeKeys(data []byte) []key {
+	var keys []key
+	for len(data) > 0 {
+		b := data[0]
+		switch {
+		case b == 0x1b:
+			k, n := decodeEscape(data)
+			keys = append(keys, k)
+			data = data[n:]
+			continue
+		case b == '\r' || b == '\n':
+			keys = append(keys, key{code: keyEnter})
+		case b == 0x7f || b == 0x08:
+			keys = append(keys, key{code: keyBackspace})
+		case b == 0x01:
+			keys = append(keys, key{code: keyHome})
+		case b == 0x05:
+			keys = append(keys, key{code: keyEnd})
+		case b == 0x02:
+			keys = append(keys, key{code: keyLeft})
+		case b == 0x06:
+			keys = append(keys, key{code: keyRight})
+		case b == 0x10:
+			keys = append(keys, key{code: keyUp})
+		case b == 0x0e:
+			keys = append(keys, key{code: keyDown})
+		case b == 0x03:
+			keys = append(keys, key{code: keyCtrlC})
+		case b == 0x04:
+			keys = append(keys, key{code: keyCtrlD})
+		case b == 0x15:
+			keys = append(keys, key{code: keyCtrlU})
+		case b == 0x0b:
+			keys = append(keys, key{code: keyCtrlK})
+		case b == 0x17:
+			keys = append(keys, key{code: keyCtrlW})
+		case b == 0x0c:
+			keys = append(keys, key{code: keyCtrlL})
+		case b < 0x20:
+			keys = append(keys, key{code: keyUnknown})
+		default:
+			r, n := utf8.DecodeRune(data)
+			keys = append(keys, key{code: keyRune, r: r})
+			data = data[n:]
+			continue
+		}
+		data = data[1:]
+	}
+	return keys
+}
+
+func decodeEscape(data []byte) (key, int) {
+	if len(data) < 2 {
+		return key{code: keyUnknown}, len(data)
+	}
+	if data[1] == '\r' || data[1] == '\n' {
+		return key{code: keyAltEnter}, 2
+	}
+	if data[1] != '[' && data[1] != 'O' {
+		return key{code: keyUnknown}, 2
+	}
+	// CSI / SS3: parameters then a final byte in 0x40..0x7e.
+	end := 2
+	for end < len(data) && (data[end] < 0x40 || data[end] > 0x7e) {
+		end++
+	}
+	if end >= len(data) {
+		return key{code: keyUnknown}, len(data)
+	}
+	seq := string(data[2:end])
+	switch data[end] {
+	case 'A':
+		return key{code: keyUp}, end + 1
+	case 'B':
+		return key{code: keyDown}, end + 1
+	case 'C':
+		return key{code: keyRight}, end + 1
+	case 'D':
+		return key{code: keyLeft}, end + 1
+	case 'H':
+		return key{code: keyHome}, end + 1
+	case 'F':
+		return key{code: keyEnd}, end + 1
+	case '~':
+		switch seq {
+		case "1", "7":
+			return key{code: keyHome}, end + 1
+		case "4", "8":
+			return key{code: keyEnd}, end + 1
+		case "3":
+			return key{code: keyDelete}, end + 1
+		}
+	}
+	return key{code: keyUnknown}, end + 1
+}
+
+// lineEditor is the TUI input line. Finished lines of a multi-line message
+// are kept in lines while buf holds the line being edited.
+type lineEditor struct {
+	buf   []rune
+	pos   int
+	lines []string
+
+	history []string
+	histPos int
+	draft   []rune
+}
+
+// handle applies k and returns the composed message when k submits it.
+func (e *lineEditor) handle(k key) (message string, submitted bool) {
+	switch k.code {
+	case keyRune:
+		e.buf = append(e.buf[:e.pos], append([]rune{k.r}, e.buf[e.pos:]...)...)
+		e.pos++
+	case keyEnter:
+		if n := len(e.buf); n > 0 && e.buf[n-1] == '\\' {
+			e.lines = append(e.lines, string(e.buf[:n-1]))
+			e.setBuf(nil)
+			return "", false
+		}
+		message = strings.Join(append(e.lines, string(e.buf)), "\n")
+		e.lines = nil
+		e.setBuf(nil)
+		e.histPos = len(e.history)
+		return message, true
+	case keyAltEnter:
+		e.lines = append(e.lines, string(e.buf))
+		e.setBuf(nil)
+	case keyBackspace:
+		if e.pos > 0 {
+			e.buf = append(e.buf[:e.pos-1], e.buf[e.pos:]...)
+			e.pos--
+		} else if len(e.buf) == 0 && len(e.lines) > 0 {
+			last := e.lines[len(e.lines)-1]
+			e.lines = e.lines[:len(e.lines)-1]
+			e.setBuf([]rune(last))
+		}
+	case keyDelete:
+		if e.pos < len(e.buf) {
+			e.buf = append(e.buf[:e.pos], e.buf[e.pos+1:]...)
+		}
+	case keyLeft:
+		if e.pos > 0 {
+			e.pos--
+		}
+	case keyRight:
+		if e.pos < len(e.buf) {
+			e.pos++
+		}
+	case keyHome:
+		e.pos = 0
+	case keyEnd:
+		e.pos = len(e.buf)
+	case keyCtrlU:
+		e.buf = append([]rune(nil), e.buf[e.pos:]...)
+		e.pos = 0
+	case keyCtrlK:
+		e.buf = e.buf[:e.pos]
+	case keyCtrlW:
+		start := e.pos
+		for start > 0 && unicode.IsSpace(e.buf[start-1]) {
+			start--
+		}
+		for start > 0 && !unicode.IsSpace(e.buf[start-1]) {
+			start--
+		}
+		e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+		e.pos = start
+	case keyUp:
+		if e.histPos > 0 {
+			if e.histPos == len(e.history) {
+				e.draft = append([]rune(nil), e.buf...)
+			}
+			e.histPos--
+			e.setBuf([]rune(e.history[e.histPos]))
+		}
+	case keyDown:
+		if e.histPos < len(e.history) {
+			e.histPos++
+			if e.histPos == len(e.history) {
+				e.setBuf(e.draft)
+			} else {
+				e.setBuf([]rune(e.history[e.histPos]))
+			}
+		}
+	}
+	return "", false
+}
+
+func (e *lineEditor) setBuf(r []rune) {
+	e.buf = append([]rune(nil), r...)
+	e.pos = len(e.buf)
+}
+
+func (e *lineEditor) empty() bool {
+	return len(e.buf) == 0 && len(e.lines) == 0
+}
+
+func (e *lineEditor) clear() {
+	e.lines = nil
+	e.setBuf(nil)
+	e.histPos = len(e.history)
+}
+
+// remember adds message to the history, skipping immediate repeats.
+func (e *lineEditor) remember(message string) {
+	if message == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == message) {
+		e.histPos = len(e.history)
+		return
+	}
+	e.history = append(e.history, message)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	e.histPos = len(e.history)
+}
+
+// loadHistory reads a history file written by saveHistory: one quoted
+// entry per line, so multi-line messages survive.
+func loadHistory(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var history []string
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		if entry, err := strconv.Unquote(scanner.Text()); err == nil {
+			history = append(history, entry)
+		}
+	}
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	return history
+}
+
+func saveHistory(path string, history []string) error {
+	var b strings.Builder
+	for _, entry := range history {
+		b.WriteString(strconv.Quote(entry))
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o600)
+}
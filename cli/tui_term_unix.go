@@ -0,0 +1,52 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// openTerminal switches the controlling terminal to unbuffered, no-echo
+// input using stty, so no terminal library is needed.
+func openTerminal() (*terminal, error) {
+	if stdinPiped() {
+		return nil, errors.New("the TUI needs an interactive terminal on stdin")
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("stty: %w", err)
+	}
+	if _, err := stty("-icanon", "-echo", "-isig", "-ixon", "min", "1", "time", "0"); err != nil {
+		return nil, fmt.Errorf("stty: %w", err)
+	}
+	t := &terminal{restoreMode: func() { _, _ = stty(saved) }}
+	t.rows, t.cols = terminalSize()
+	return t, nil
+}
+
+func terminalSize() (rows, cols int) {
+	out, err := stty("size")
+	if err == nil {
+		if _, err := fmt.Sscan(out, &rows, &cols); err == nil && rows > 2 && cols > 10 {
+			return rows, cols
+		}
+	}
+	return 24, 80
+}
+
+func notifyResize(ch chan<- os.Signal) {
+	signal.Notify(ch, syscall.SIGWINCH)
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func openTerminal() (*terminal, error) {
+	return nil, errors.New("the TUI is not supported on Windows; use the line mode")
+}
+
+func terminalSize() (rows, cols int) {
+	return 24, 80
+}
+
+func notifyResize(chan<- os.Signal) {}
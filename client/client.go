@@ -0,0 +1,531 @@
+// Package client is a Go client for the bridge protocol. Dial opens a relay
+// session; the Session sends events and delivers the connector's events on
+// a channel, reassembling streamed media attachments on the way.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// ErrClosed is returned by Send and Stop after the session has ended.
+var ErrClosed = errors.New("client: session closed")
+
+// ErrSessionClosed is the session error when the relay closed the session,
+// for example because the connector went away.
+var ErrSessionClosed = errors.New("client: session closed by relay")
+
+// ErrDisconnected is returned by Stop while the session is reconnecting.
+// Runs do not survive a reconnect, so there is nothing left to stop.
+var ErrDisconnected = errors.New("client: session reconnecting")
+
+// ErrFrameTooLarge is returned by Send for an event whose frame exceeds the
+// negotiated max_frame_size.
+var ErrFrameTooLarge = errors.New("client: frame exceeds max_frame_size")
+
+// DefaultDialer is websocket.DefaultDialer with permessage-deflate enabled.
+var DefaultDialer = &websocket.Dialer{
+	Proxy:             http.ProxyFromEnvironment,
+	HandshakeTimeout:  45 * time.Second,
+	EnableCompression: true,
+}
+
+// ConnectError is an ERROR control message received while connecting.
+type ConnectError struct {
+	Code    string
+	Message string
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("connect error %s: %s", e.Code, e.Message)
+}
+
+type Options struct {
+	// Caps are sent with CONNECT; Caps.Events subscribes to optional events.
+	// The client always advertises attachment support and the payload
+	// compression it implements, replacing those fields.
+	Caps *protocol.Caps
+	// Reconnect opens a new session when the connection drops or the relay
+	// closes the session. Runs in flight get a CONNECTION_LOST error event.
+	Reconnect bool
+	// ReconnectDelay is the pause between reconnect attempts. Default 2s.
+	ReconnectDelay time.Duration
+	// Dialer defaults to DefaultDialer.
+	Dialer *websocket.Dialer
+	// EventBuffer is the capacity of the Events channel. Default 64.
+	EventBuffer int
+	// OnDisconnect and OnReconnect are called from the session goroutine
+	// when the connection drops and when a new session replaces it.
+	OnDisconnect func(err error)
+	OnReconnect  func(sessionID string)
+}
+
+// Session is a client session on the relay. It is safe for concurrent use.
+type Session struct {
+	url        string
+	accessCode string
+	opts       Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	conn      *websocket.Conn
+	id        string
+	version   int
+	caps      protocol.Caps
+	connected chan struct{}
+	inflight  map[string]int
+	closing   bool
+	err       error
+
+	writeMu sync.Mutex
+	events  chan protocol.Event
+	done    chan struct{}
+}
+
+// Dial connects to the relay client endpoint url and opens a session for
+// accessCode. ctx bounds connecting only; Close ends the session.
+func Dial(ctx context.Context, url, accessCode string, opts Options) (*Session, error) {
+	if opts.ReconnectDelay <= 0 {
+		opts.ReconnectDelay = 2 * time.Second
+	}
+	if opts.Dialer == nil {
+		opts.Dialer = DefaultDialer
+	}
+	if opts.EventBuffer <= 0 {
+		opts.EventBuffer = 64
+	}
+
+	s := &Session{
+		url:        url,
+		accessCode: accessCode,
+		opts:       opts,
+		inflight:   make(map[string]int),
+		events:     make(chan protocol.Event, opts.EventBuffer),
+		done:       make(chan struct{}),
+	}
+	conn, ok, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.setConn(conn, ok)
+	go s.run(conn)
+	return s, nil
+}
+
+func (s *Session) connect(ctx context.Context) (*websocket.Conn, protocol.ControlMessage, error) {
+	conn, _, err := s.opts.Dialer.DialContext(ctx, s.url, nil)
+	if err != nil {
+		return nil, protocol.ControlMessage{}, fmt.Errorf("connect relay: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetReadDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	ok, err := Handshake(conn, s.accessCode, s.opts.Caps)
+	stop()
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, protocol.ControlMessage{}, err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	return conn, ok, nil
+}
+
+// ConnectMessage returns the CONNECT the client sends: every supported
+// protocol version and caps with attachment support and payload compression
+// added.
+func ConnectMessage(accessCode string, caps *protocol.Caps) protocol.ControlMessage {
+	var advertised protocol.Caps
+	if caps != nil {
+		advertised = *caps
+	}
+	advertised.Attachments = true
+	advertised.Compression = protocol.SupportedCompression
+	return protocol.ControlMessage{
+		Type:       protocol.TypeConnect,
+		V:          protocol.SupportedVersions[0],
+		Versions:   protocol.SupportedVersions,
+		AccessCode: accessCode,
+		Caps:       &advertised,
+	}
+}
+
+// Handshake sends CONNECT on a fresh relay connection and waits for
+// CONNECT_OK, which it returns with the session id, the negotiated version
+// and capabilities.
+func Handshake(conn *websocket.Conn, accessCode string, caps *protocol.Caps) (protocol.ControlMessage, error) {
+	connectData, err := protocol.EncodeControl(ConnectMessage(accessCode, caps))
+	if err != nil {
+		return protocol.ControlMessage{}, fmt.Errorf("encode connect: %w", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, connectData); err != nil {
+		return protocol.ControlMessage{}, fmt.Errorf("send connect: %w", err)
+	}
+
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return protocol.ControlMessage{}, err
+		}
+		if msgType != websocket.TextMessage {
+			continue
+		}
+		msg, err := protocol.DecodeControl(data)
+		var versionErr *protocol.VersionError
+		if errors.As(err, &versionErr) && msg.Type == protocol.TypeConnectOK {
+			return protocol.ControlMessage{}, fmt.Errorf("relay chose protocol version %d: %w", msg.V, err)
+		}
+		if err != nil {
+			continue
+		}
+		switch msg.Type {
+		case protocol.TypeConnectOK:
+			if msg.SessionID == "" {
+				return protocol.ControlMessage{}, errors.New("missing session_id")
+			}
+			if msg.Caps == nil {
+				msg.Caps = &protocol.Caps{}
+			}
+			return msg, nil
+		case protocol.TypeError:
+			return protocol.ControlMessage{}, &ConnectError{Code: msg.Code, Message: msg.Message}
+		}
+	}
+}
+
+// ID returns the current session id. It changes after a reconnect.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.id
+}
+
+// Caps returns the capabilities negotiated in CONNECT_OK: what the client,
+// the relay and the connector all support.
+func (s *Session) Caps() protocol.Caps {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.caps
+}
+
+// Version returns the protocol version negotiated in CONNECT_OK.
+func (s *Session) Version() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// Events delivers the session's events in order. It is closed when the
+// session ends; Err then reports why.
+func (s *Session) Events() <-chan protocol.Event {
+	return s.events
+}
+
+// Done is closed when the session has ended.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the reason the session ended: nil after Close, otherwise the
+// connection error or ErrSessionClosed.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Send writes event to the session. While a reconnect is in progress it
+// waits for the new session; use SendContext to bound the wait.
+func (s *Session) Send(event protocol.Event) error {
+	return s.SendContext(context.Background(), event)
+}
+
+// SendContext is Send that gives up waiting for a reconnect when ctx is
+// done, returning ctx.Err().
+func (s *Session) SendContext(ctx context.Context, event protocol.Event) error {
+	return s.send(ctx, event, true)
+}
+
+// Stop asks the connector to stop the run started by the user_message with
+// eventID, or every run of the session when eventID is empty. It fails with
+// ErrDisconnected instead of waiting for a reconnect.
+func (s *Session) Stop(eventID string) error {
+	return s.send(context.Background(), protocol.Event{Type: "control", Action: "stop", ID: eventID}, false)
+}
+
+func (s *Session) send(ctx context.Context, event protocol.Event, wait bool) error {
+	payload, err := protocol.EncodeEvent(event)
+	if err != nil {
+		return fmt.Errorf("encode event: %w", err)
+	}
+	for {
+		s.mu.Lock()
+		conn, id, connected, caps := s.conn, s.id, s.connected, s.caps
+		s.mu.Unlock()
+		if conn == nil {
+			select {
+			case <-s.done:
+				return ErrClosed
+			default:
+			}
+			if !wait {
+				return ErrDisconnected
+			}
+			select {
+			case <-connected:
+				continue
+			case <-s.done:
+				return ErrClosed
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		// The limit applies to the uncompressed frame, which is what the
+		// receiver may inflate it to.
+		if limit := caps.MaxFrameSize; limit > 0 && 2+len(id)+len(payload) > limit {
+			return fmt.Errorf("%w: %d bytes, limit %d", ErrFrameTooLarge, 2+len(id)+len(payload), limit)
+		}
+		flags, data := protocol.CompressPayload(caps.CompressionAlgorithm(), 0, payload)
+		frame, err := protocol.BuildDataFrame(id, flags, data)
+		if err != nil {
+			return fmt.Errorf("build frame: %w", err)
+		}
+		if event.Type == protocol.EventUserMessage {
+			s.track(event.ID, 1)
+		}
+		s.writeMu.Lock()
+		conn.EnableWriteCompression(protocol.WireCompressible(flags))
+		err = conn.WriteMessage(websocket.BinaryMessage, frame)
+		s.writeMu.Unlock()
+		if err != nil && event.Type == protocol.EventUserMessage {
+			s.track(event.ID, -1)
+		}
+		return err
+	}
+}
+
+// Close sends CLOSE_SESSION and ends the session.
+func (s *Session) Close() error {
+	s.mu.Lock()
+	conn, id := s.conn, s.id
+	s.mu.Unlock()
+	if conn != nil {
+		if data, err := protocol.EncodeControl(protocol.ControlMessage{Type: protocol.TypeCloseSession, SessionID: id}); err == nil {
+			s.writeMu.Lock()
+			conn.EnableWriteCompression(true)
+			_ = conn.WriteMessage(websocket.TextMessage, data)
+			s.writeMu.Unlock()
+		}
+	}
+	s.mu.Lock()
+	s.closing = true
+	s.mu.Unlock()
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+func (s *Session) setConn(conn *websocket.Conn, ok protocol.ControlMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conn, s.id, s.version, s.caps = conn, ok.SessionID, ok.V, *ok.Caps
+	if s.connected != nil {
+		close(s.connected)
+		s.connected = nil
+	}
+}
+
+func (s *Session) track(eventID string, delta int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inflight[eventID] += delta
+	if s.inflight[eventID] <= 0 {
+		delete(s.inflight, eventID)
+	}
+}
+
+// release ends one in-flight message with eventID, if there is one. Terminal
+// events for ids that were never sent must not hide a later CONNECTION_LOST.
+func (s *Session) release(eventID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch n := s.inflight[eventID]; {
+	case n > 1:
+		s.inflight[eventID] = n - 1
+	case n == 1:
+		delete(s.inflight, eventID)
+	}
+}
+
+// run reads the connection until the session ends, reconnecting if
+// enabled.
+func (s *Session) run(conn *websocket.Conn) {
+	defer close(s.done)
+	defer close(s.events)
+	stop := context.AfterFunc(s.ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.conn != nil {
+			_ = s.conn.Close()
+		}
+	})
+	defer stop()
+
+	for {
+		err := s.read(conn)
+		s.mu.Lock()
+		s.conn = nil
+		s.connected = make(chan struct{})
+		s.mu.Unlock()
+		_ = conn.Close()
+
+		if s.ctx.Err() != nil {
+			s.finish(s.ctx.Err())
+			return
+		}
+		if s.opts.OnDisconnect != nil {
+			s.opts.OnDisconnect(err)
+		}
+		if !s.failInflight(err) {
+			s.finish(s.ctx.Err())
+			return
+		}
+		if !s.opts.Reconnect {
+			s.finish(err)
+			return
+		}
+
+		next, ok := s.reconnect()
+		if !ok {
+			s.finish(s.ctx.Err())
+			return
+		}
+		conn = next
+	}
+}
+
+// finish records why the session ended. Close ends it without an error.
+func (s *Session) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		err = nil
+	}
+	s.err = err
+}
+
+func (s *Session) reconnect() (*websocket.Conn, bool) {
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil, false
+		case <-time.After(s.opts.ReconnectDelay):
+		}
+		conn, ok, err := s.connect(s.ctx)
+		if err != nil {
+			continue
+		}
+		s.setConn(conn, ok)
+		if s.opts.OnReconnect != nil {
+			s.opts.OnReconnect(ok.SessionID)
+		}
+		return conn, true
+	}
+}
+
+// failInflight ends every run still waiting for a terminal event with a
+// CONNECTION_LOST error. It reports false if the session context ended
+// while delivering them.
+func (s *Session) failInflight(cause error) bool {
+	s.mu.Lock()
+	var ids []string
+	for id, n := range s.inflight {
+		for ; n > 0; n-- {
+			ids = append(ids, id)
+		}
+	}
+	clear(s.inflight)
+	s.mu.Unlock()
+
+	for _, id := range ids {
+		event := protocol.Event{Type: protocol.EventError, ID: id, Code: "CONNECTION_LOST", Message: cause.Error()}
+		if !s.deliver(event) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Session) deliver(event protocol.Event) bool {
+	select {
+	case s.events <- event:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// read delivers the events of one connection and returns the error that
+// ended it.
+func (s *Session) read(conn *websocket.Conn) error {
+	s.mu.Lock()
+	sessionID, caps := s.id, s.caps
+	s.mu.Unlock()
+	media := newMediaAssembler()
+	for {
+		msgType, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if msgType == websocket.TextMessage {
+			msg, err := protocol.DecodeControl(data)
+			if err == nil && msg.Type == protocol.TypeCloseSession && msg.SessionID == sessionID {
+				return ErrSessionClosed
+			}
+			continue
+		}
+
+		sid, flags, payload, err := protocol.ParseDataFrame(data)
+		if err != nil || sid != sessionID {
+			continue
+		}
+		flags, payload, err = protocol.DecompressPayload(caps.CompressionAlgorithm(), flags, payload, caps.MaxFrameSize)
+		if err != nil {
+			continue
+		}
+		if flags&protocol.FlagAttachment != 0 {
+			media.addChunk(payload)
+			continue
+		}
+		event, err := protocol.DecodeEvent(payload)
+		if err != nil {
+			continue
+		}
+		if event.Type == protocol.EventMedia {
+			media.resolve(&event)
+		}
+		// Errors without an id, such as BAD_EVENT, answer no particular
+		// message.
+		if event.Type == protocol.EventEnd || (event.Type == protocol.EventError && event.ID != "") {
+			s.release(event.ID)
+		}
+		if !s.deliver(event) {
+			return s.ctx.Err()
+		}
+	}
+}
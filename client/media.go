@@ -0,0 +1,52 @@
+package client
+
+import (
+	"encoding/base64"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// mediaAssembler collects attachment chunks streamed ahead of media events.
+type mediaAssembler struct {
+	partial  map[string][]byte
+	complete map[string][]byte
+}
+
+func newMediaAssembler() *mediaAssembler {
+	return &mediaAssembler{partial: map[string][]byte{}, complete: map[string][]byte{}}
+}
+
+func (m *mediaAssembler) addChunk(payload []byte) {
+	chunk, err := protocol.DecodeAttachmentChunk(payload)
+	if err != nil {
+		return
+	}
+	buf := m.partial[chunk.ID]
+	if uint64(len(buf)) != chunk.Offset {
+		delete(m.partial, chunk.ID)
+		return
+	}
+	buf = append(buf, chunk.Data...)
+	if !chunk.Final {
+		m.partial[chunk.ID] = buf
+		return
+	}
+	delete(m.partial, chunk.ID)
+	m.complete[chunk.ID] = buf
+}
+
+// resolve inlines the streamed content referenced by a media event.
+func (m *mediaAssembler) resolve(event *protocol.Event) {
+	if event.Media == nil || event.Media.AttachmentID == "" {
+		return
+	}
+	data, ok := m.complete[event.Media.AttachmentID]
+	if !ok {
+		return
+	}
+	delete(m.complete, event.Media.AttachmentID)
+	media := *event.Media
+	media.Data = base64.StdEncoding.EncodeToString(data)
+	media.AttachmentID = ""
+	event.Media = &media
+}
@@ -7,14 +7,11 @@ import (
 	"log"
 	"os"
 	"os/signal"
-	"sync"
 	"syscall"
 
-	"openclaw-bridge/connector/pkg/bridge"
 	"openclaw-bridge/connector/pkg/config"
+	"openclaw-bridge/connector/pkg/connector"
 	"openclaw-bridge/connector/pkg/gatewayclient"
-	"openclaw-bridge/connector/pkg/relayclient"
-	"openclaw-bridge/shared/protocol"
 )
 
 func main() {
@@ -31,77 +28,24 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer cancel()
 
-	var bridgeHandler *bridge.GatewayBridge
-
-	relay := relayclient.New(cfg, logger,
-		func(msg protocol.ControlMessage) {
-			switch msg.Type {
-			case protocol.TypeSessionOpen:
-				bridgeHandler.OpenSession(msg.SessionID)
-				logger.Printf("session open sid=%s", msg.SessionID)
-			case protocol.TypeCloseSession:
-				bridgeHandler.CloseSession(msg.SessionID)
-				logger.Printf("session close sid=%s", msg.SessionID)
-			case protocol.TypeError:
-				logger.Printf("relay error code=%s message=%s", msg.Code, msg.Message)
-			}
-		},
-		func(sessionID string, flags byte, payload []byte) {
-			bridgeHandler.HandleData(sessionID, flags, payload)
-		},
-	)
-	bridgeHandler = bridge.NewGatewayBridge(logger, relay)
-
-	gateway := gatewayclient.New(cfg.Gateway, logger, gatewayclient.Handlers{
-		OnEvent: func(sessionID string, event protocol.Event) {
-			bridgeHandler.HandleGatewayEvent(sessionID, event)
-		},
-		OnDisconnected: func(err error) {
-			bridgeHandler.HandleGatewayDisconnected(err)
-		},
-		OnReady: func() {
-			logger.Printf("gateway connected and ready")
-		},
-	})
-	bridgeHandler.BindGateway(gateway)
+	conn, err := connector.New(cfg, logger, connector.Options{})
+	if err != nil {
+		logger.Fatalf("create backend error=%v", err)
+	}
 
 	logger.Printf(
-		"start relay_url=%s access_code_hash=%s gateway_url=%s",
+		"start relay_url=%s access_code_hash=%s mode=%s gateway_url=%s strict_routing=%t",
 		cfg.RelayURL,
 		cfg.AccessCodeHash,
+		cfg.Mode,
 		cfg.Gateway.URL,
+		cfg.Gateway.Strict(),
 	)
 
-	errCh := make(chan error, 2)
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		errCh <- relay.Run(ctx)
-	}()
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		errCh <- gateway.Run(ctx)
-	}()
-
-	var runErr error
-	for i := 0; i < 2; i++ {
-		if err := <-errCh; err != nil {
-			runErr = err
-			cancel()
-			break
-		}
-	}
-	wg.Wait()
-	close(errCh)
-
-	if runErr != nil {
-		if errors.Is(runErr, gatewayclient.ErrGatewayAuthFailed) {
-			logger.Fatalf("Gateway auth failed: %v", runErr)
+	if err := conn.Run(ctx); err != nil {
+		if errors.Is(err, gatewayclient.ErrGatewayAuthFailed) {
+			logger.Fatalf("Gateway auth failed: %v", err)
 		}
-		logger.Fatalf("connector exited err=%v", runErr)
+		logger.Fatalf("connector exited err=%v", err)
 	}
 }
@@ -0,0 +1,236 @@
+package attachments
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// DefaultAllowedTypes are accepted when Limits.AllowedTypes is empty.
+var DefaultAllowedTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"text/plain",
+	"text/markdown",
+	"text/csv",
+	"application/json",
+}
+
+// Defaults for Limits left at zero, matching config.Load.
+const (
+	DefaultMaxBytes      = 20 << 20
+	DefaultMaxPerSession = 8
+	DefaultIdleTimeout   = 120 * time.Second
+)
+
+type Limits struct {
+	MaxBytes      int64
+	MaxPerSession int
+	AllowedTypes  []string
+	// IdleTimeout drops uploads that receive no chunk for this long.
+	IdleTimeout time.Duration
+}
+
+// Error carries the event error code reported to the client.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// File is a fully received and validated attachment.
+type File struct {
+	Name     string
+	MimeType string
+	Data     []byte
+}
+
+func (f File) IsImage() bool {
+	return strings.HasPrefix(f.MimeType, "image/")
+}
+
+type upload struct {
+	data     []byte
+	complete bool
+	touched  time.Time
+}
+
+// Store reassembles attachment chunks per session.
+type Store struct {
+	limits Limits
+
+	mu      sync.Mutex
+	uploads map[string]map[string]*upload
+}
+
+func NewStore(limits Limits) *Store {
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultMaxBytes
+	}
+	if limits.MaxPerSession <= 0 {
+		limits.MaxPerSession = DefaultMaxPerSession
+	}
+	if limits.IdleTimeout <= 0 {
+		limits.IdleTimeout = DefaultIdleTimeout
+	}
+	if len(limits.AllowedTypes) == 0 {
+		limits.AllowedTypes = DefaultAllowedTypes
+	}
+	return &Store{limits: limits, uploads: make(map[string]map[string]*upload)}
+}
+
+// AddChunk appends chunk to its upload. Chunks must arrive in order.
+func (s *Store) AddChunk(sessionID string, chunk protocol.AttachmentChunk) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bySession := s.uploads[sessionID]
+	if bySession == nil {
+		bySession = make(map[string]*upload)
+		s.uploads[sessionID] = bySession
+	}
+	up, ok := bySession[chunk.ID]
+	if !ok {
+		if chunk.Offset != 0 {
+			return errorf("ATTACHMENT_BAD_OFFSET", "attachment %s must start at offset 0", chunk.ID)
+		}
+		if len(bySession) >= s.limits.MaxPerSession {
+			return errorf("ATTACHMENT_LIMIT", "at most %d pending attachments per session", s.limits.MaxPerSession)
+		}
+		up = &upload{}
+		bySession[chunk.ID] = up
+	}
+	if up.complete {
+		return errorf("ATTACHMENT_COMPLETE", "attachment %s already completed", chunk.ID)
+	}
+	if chunk.Offset != uint64(len(up.data)) {
+		delete(bySession, chunk.ID)
+		return errorf("ATTACHMENT_BAD_OFFSET", "attachment %s expected offset %d got %d", chunk.ID, len(up.data), chunk.Offset)
+	}
+	if int64(len(up.data)+len(chunk.Data)) > s.limits.MaxBytes {
+		delete(bySession, chunk.ID)
+		return errorf("ATTACHMENT_TOO_LARGE", "attachment %s exceeds %d bytes", chunk.ID, s.limits.MaxBytes)
+	}
+
+	up.data = append(up.data, chunk.Data...)
+	up.complete = chunk.Final
+	up.touched = time.Now()
+	return nil
+}
+
+// Take removes a completed upload and validates it against ref.
+func (s *Store) Take(sessionID string, ref protocol.AttachmentRef) (File, error) {
+	s.mu.Lock()
+	up, ok := s.uploads[sessionID][ref.ID]
+	if ok && up.complete {
+		delete(s.uploads[sessionID], ref.ID)
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		return File{}, errorf("ATTACHMENT_NOT_FOUND", "attachment %s not uploaded", ref.ID)
+	}
+	if !up.complete {
+		return File{}, errorf("ATTACHMENT_INCOMPLETE", "attachment %s still uploading", ref.ID)
+	}
+	if ref.Size != int64(len(up.data)) {
+		return File{}, errorf("ATTACHMENT_SIZE_MISMATCH", "attachment %s declared %d bytes, received %d", ref.ID, ref.Size, len(up.data))
+	}
+
+	mimeType, err := s.checkType(ref, up.data)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: ref.Name, MimeType: mimeType, Data: up.data}, nil
+}
+
+// DropSession forgets every upload of a closed session.
+func (s *Store) DropSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, sessionID)
+}
+
+// checkType resolves the attachment MIME type and verifies that the content
+// matches it. Text-like types only need to sniff as text.
+func (s *Store) checkType(ref protocol.AttachmentRef, data []byte) (string, error) {
+	sniffed := baseType(http.DetectContentType(data))
+	declared := baseType(ref.MimeType)
+	if declared == "" {
+		declared = sniffed
+	}
+	if !s.allowed(declared) {
+		return "", errorf("ATTACHMENT_TYPE_UNSUPPORTED", "attachment %s type %s not allowed", ref.ID, declared)
+	}
+
+	textual := strings.HasPrefix(declared, "text/") || declared == "application/json"
+	switch {
+	case textual && sniffed == "text/plain":
+	case declared == sniffed:
+	default:
+		return "", errorf("ATTACHMENT_TYPE_MISMATCH", "attachment %s declared %s but content is %s", ref.ID, declared, sniffed)
+	}
+	return declared, nil
+}
+
+func (s *Store) allowed(mimeType string) bool {
+	for _, t := range s.limits.AllowedTypes {
+		if strings.EqualFold(t, mimeType) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run drops idle uploads until ctx is done.
+func (s *Store) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.limits.IdleTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sweep(now.Add(-s.limits.IdleTimeout))
+		}
+	}
+}
+
+// sweep drops uploads that received no chunk since cutoff.
+func (s *Store) sweep(cutoff time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sid, bySession := range s.uploads {
+		for id, up := range bySession {
+			if up.touched.Before(cutoff) {
+				delete(bySession, id)
+			}
+		}
+		if len(bySession) == 0 {
+			delete(s.uploads, sid)
+		}
+	}
+}
+
+func baseType(mimeType string) string {
+	if i := strings.IndexByte(mimeType, ';'); i >= 0 {
+		mimeType = mimeType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(mimeType))
+}
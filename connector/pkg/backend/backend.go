@@ -0,0 +1,61 @@
+// Package backend provides the agents a connector can front: the OpenClaw
+// gateway, or a local stand-in selected by the config mode.
+package backend
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"openclaw-bridge/connector/pkg/config"
+	"openclaw-bridge/connector/pkg/gatewayclient"
+	"openclaw-bridge/shared/protocol"
+)
+
+// Backend answers user messages forwarded by the bridge. Events it produces
+// are delivered through the Handlers it was created with.
+type Backend interface {
+	SendUserMessage(sessionID string, event protocol.Event) error
+	SendCancel(sessionID, eventID string) error
+	IsReady() bool
+	// Run serves until ctx is cancelled or a fatal error occurs.
+	Run(ctx context.Context) error
+}
+
+// Handlers mirrors gatewayclient.Handlers so every backend reports to the
+// bridge the same way.
+type Handlers struct {
+	OnEvent        func(sessionID string, event protocol.Event)
+	OnDisconnected func(err error)
+	OnReady        func()
+}
+
+// Error carries the event error code reported to the client.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// New builds the backend selected by cfg.Mode.
+func New(cfg config.Config, logger *log.Logger, handlers Handlers) (Backend, error) {
+	switch cfg.Mode {
+	case config.ModeGateway:
+		return gatewayclient.New(cfg.Gateway, logger, gatewayclient.Handlers(handlers)), nil
+	case config.ModeEcho:
+		return NewEcho(logger, handlers), nil
+	case config.ModeOpenAI:
+		return NewOpenAI(cfg.OpenAI, logger, handlers), nil
+	case config.ModeExec:
+		return NewExec(cfg.Exec, logger, handlers), nil
+	default:
+		return nil, fmt.Errorf("mode %q is not supported", cfg.Mode)
+	}
+}
@@ -0,0 +1,25 @@
+package backend
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// NewEcho returns a backend that streams each message back word by word,
+// for smoke-testing a relay and connector without an agent.
+func NewEcho(logger *log.Logger, handlers Handlers) Backend {
+	return newLocal(logger, handlers, 0, respondEcho)
+}
+
+func respondEcho(ctx context.Context, _ string, event protocol.Event, emit func(protocol.Event)) (*protocol.RunMeta, error) {
+	for _, part := range strings.Fields(event.Content) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		emit(protocol.Event{Type: protocol.EventToken, Content: part + " "})
+	}
+	return &protocol.RunMeta{Model: "echo", StopReason: "stop"}, nil
+}
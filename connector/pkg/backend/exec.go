@@ -0,0 +1,210 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"openclaw-bridge/connector/pkg/config"
+	"openclaw-bridge/shared/protocol"
+)
+
+// stderrTail bounds how much of a failed command's stderr is reported.
+const stderrTail = 2048
+
+// NewExec returns a backend that runs cfg.Command once per message. The
+// message text is written to stdin and stdout is streamed back as tokens.
+// Images and files are written to the images and files subdirectories of a
+// temporary directory named by OPENCLAW_ATTACHMENT_DIR for the lifetime of
+// the command.
+func NewExec(cfg config.ExecConfig, logger *log.Logger, handlers Handlers) Backend {
+	timeout := time.Duration(cfg.TimeoutSeconds) * time.Second
+	return newLocal(logger, handlers, timeout, func(ctx context.Context, sessionID string, event protocol.Event, emit func(protocol.Event)) (*protocol.RunMeta, error) {
+		return respondExec(ctx, cfg, sessionID, event, emit)
+	})
+}
+
+func respondExec(ctx context.Context, cfg config.ExecConfig, sessionID string, event protocol.Event, emit func(protocol.Event)) (*protocol.RunMeta, error) {
+	cmd := exec.CommandContext(ctx, cfg.Command[0], cfg.Command[1:]...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = append(os.Environ(), cfg.Env...)
+	cmd.Env = append(cmd.Env, "OPENCLAW_SESSION_ID="+sessionID, "OPENCLAW_EVENT_ID="+event.ID)
+	cmd.Stdin = strings.NewReader(event.Content)
+	cmd.WaitDelay = 2 * time.Second
+
+	if len(event.Images) > 0 || len(event.Files) > 0 {
+		dir, err := writeAttachments(event)
+		if err != nil {
+			return nil, errorf("EXEC_ATTACHMENTS_FAILED", "%v", err)
+		}
+		defer os.RemoveAll(dir)
+		cmd.Env = append(cmd.Env, "OPENCLAW_ATTACHMENT_DIR="+dir)
+	}
+
+	var stderr tailBuffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errorf("EXEC_START_FAILED", "%v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errorf("EXEC_START_FAILED", "%v", err)
+	}
+
+	streamErr := streamTokens(stdout, emit)
+	waitErr := cmd.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if waitErr != nil {
+		msg := waitErr.Error()
+		if tail := strings.TrimSpace(stderr.String()); tail != "" {
+			msg += ": " + tail
+		}
+		return nil, errorf("EXEC_FAILED", "%s", msg)
+	}
+	if streamErr != nil {
+		return nil, errorf("EXEC_FAILED", "read stdout: %v", streamErr)
+	}
+	return &protocol.RunMeta{Model: filepath.Base(cfg.Command[0]), StopReason: "exit"}, nil
+}
+
+// streamTokens emits everything read from r as token events, holding back an
+// incomplete trailing UTF-8 sequence until the rest of it arrives.
+func streamTokens(r io.Reader, emit func(protocol.Event)) error {
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			data := append(pending, buf[:n]...)
+			cut := completeUTF8(data)
+			if cut > 0 {
+				emit(protocol.Event{Type: protocol.EventToken, Content: string(data[:cut])})
+			}
+			pending = append([]byte(nil), data[cut:]...)
+		}
+		if err != nil {
+			if len(pending) > 0 {
+				emit(protocol.Event{Type: protocol.EventToken, Content: string(pending)})
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// completeUTF8 returns the length of the longest prefix of b that does not
+// end inside a multi-byte rune.
+func completeUTF8(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(b[i]) {
+			if utf8.FullRune(b[i:]) {
+				return len(b)
+			}
+			return i
+		}
+	}
+	return len(b)
+}
+
+func writeAttachments(event protocol.Event) (string, error) {
+	dir, err := os.MkdirTemp("", "openclaw-exec-")
+	if err != nil {
+		return "", err
+	}
+	if err := writeAttachmentFiles(dir, event); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// writeAttachmentFiles writes images to dir/images as image-N.ext and files
+// to dir/files under their client-supplied names. Generated and client names
+// live in separate directories, and a file name that is already taken gets a
+// -N suffix, so nothing is overwritten.
+func writeAttachmentFiles(dir string, event protocol.Event) error {
+	imageDir := filepath.Join(dir, "images")
+	fileDir := filepath.Join(dir, "files")
+	for _, d := range []string{imageDir, fileDir} {
+		if err := os.Mkdir(d, 0o700); err != nil {
+			return err
+		}
+	}
+	for i, img := range event.Images {
+		ext := strings.TrimPrefix(img.MimeType, "image/")
+		if err := writeAttachment(imageDir, fmt.Sprintf("image-%d.%s", i+1, ext), img.Data); err != nil {
+			return err
+		}
+	}
+	for i, file := range event.Files {
+		name := filepath.Base(file.Name)
+		if name == "." || name == string(filepath.Separator) || name == "" {
+			name = fmt.Sprintf("file-%d", i+1)
+		}
+		if err := writeAttachment(fileDir, name, file.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeAttachment decodes data into dir/name, or into name-N.ext if that is
+// taken.
+func writeAttachment(dir, name, data string) error {
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for n := 1; ; n++ {
+		candidate := name
+		if n > 1 {
+			candidate = fmt.Sprintf("%s-%d%s", stem, n, ext)
+		}
+		f, err := os.OpenFile(filepath.Join(dir, candidate), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(raw)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	}
+}
+
+// tailBuffer keeps the last stderrTail bytes written to it.
+type tailBuffer struct {
+	buf bytes.Buffer
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	if extra := t.buf.Len() - stderrTail; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return t.buf.String()
+}
@@ -0,0 +1,191 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// respondFunc produces the reply to one user message. It streams events
+// through emit and returns metadata for the end event; the caller sends the
+// end or error event itself.
+type respondFunc func(ctx context.Context, sessionID string, event protocol.Event, emit func(protocol.Event)) (*protocol.RunMeta, error)
+
+// local runs a respondFunc per message in its own goroutine and turns stops
+// into context cancellation, so local backends only implement the reply.
+type local struct {
+	logger   *log.Logger
+	handlers Handlers
+	respond  respondFunc
+	timeout  time.Duration
+
+	ready atomic.Bool
+	wg    sync.WaitGroup
+
+	mu   sync.Mutex
+	base context.Context
+	runs map[string][]*localRun
+}
+
+type localRun struct {
+	eventID string
+	cancel  context.CancelFunc
+	stopped atomic.Bool
+}
+
+func newLocal(logger *log.Logger, handlers Handlers, timeout time.Duration, respond respondFunc) *local {
+	return &local{
+		logger:   logger,
+		handlers: handlers,
+		respond:  respond,
+		timeout:  timeout,
+		runs:     map[string][]*localRun{},
+	}
+}
+
+func (l *local) Run(ctx context.Context) error {
+	l.mu.Lock()
+	l.base = ctx
+	l.mu.Unlock()
+
+	l.ready.Store(true)
+	if l.handlers.OnReady != nil {
+		l.handlers.OnReady()
+	}
+	<-ctx.Done()
+	l.ready.Store(false)
+	l.wg.Wait()
+	return nil
+}
+
+func (l *local) IsReady() bool {
+	return l.ready.Load()
+}
+
+func (l *local) SendUserMessage(sessionID string, event protocol.Event) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.base == nil || l.base.Err() != nil {
+		return errors.New("backend not running")
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if l.timeout > 0 {
+		ctx, cancel = context.WithTimeout(l.base, l.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(l.base)
+	}
+	run := &localRun{eventID: event.ID, cancel: cancel}
+	l.runs[sessionID] = append(l.runs[sessionID], run)
+
+	l.wg.Add(1)
+	go l.serve(ctx, sessionID, event, run)
+	return nil
+}
+
+// SendCancel stops the run answering eventID, or every run of the session
+// when eventID is empty.
+func (l *local) SendCancel(sessionID, eventID string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	found := false
+	for _, run := range l.runs[sessionID] {
+		if eventID == "" || run.eventID == eventID {
+			run.stopped.Store(true)
+			run.cancel()
+			found = true
+		}
+	}
+	if !found {
+		if eventID == "" {
+			return errors.New("no active request")
+		}
+		return fmt.Errorf("no active request with id %q", eventID)
+	}
+	return nil
+}
+
+// CloseSession stops every run of a closed session, as a stop would, and
+// forgets them.
+func (l *local) CloseSession(sessionID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, run := range l.runs[sessionID] {
+		run.stopped.Store(true)
+		run.cancel()
+	}
+	delete(l.runs, sessionID)
+}
+
+func (l *local) serve(ctx context.Context, sessionID string, event protocol.Event, run *localRun) {
+	defer l.wg.Done()
+	defer l.finish(sessionID, run)
+
+	startedAt := time.Now()
+	var firstTokenAt time.Time
+	emit := func(ev protocol.Event) {
+		if ev.Type == protocol.EventToken && firstTokenAt.IsZero() {
+			firstTokenAt = time.Now()
+		}
+		ev.ID = event.ID
+		if l.handlers.OnEvent != nil {
+			l.handlers.OnEvent(sessionID, ev)
+		}
+	}
+
+	meta, err := l.respond(ctx, sessionID, event, emit)
+	if meta == nil {
+		meta = &protocol.RunMeta{}
+	}
+	switch {
+	case run.stopped.Load():
+		meta.StopReason = "aborted"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		emit(protocol.Event{Type: protocol.EventError, Code: "BACKEND_TIMEOUT", Message: fmt.Sprintf("no reply within %s", l.timeout)})
+		return
+	case ctx.Err() != nil:
+		emit(protocol.Event{Type: protocol.EventError, Code: "BACKEND_STOPPED", Message: "connector is shutting down"})
+		return
+	case err != nil:
+		l.logger.Printf("backend run error sid=%s id=%s err=%v", sessionID, event.ID, err)
+		var backendErr *Error
+		if errors.As(err, &backendErr) {
+			emit(protocol.Event{Type: protocol.EventError, Code: backendErr.Code, Message: backendErr.Message})
+		} else {
+			emit(protocol.Event{Type: protocol.EventError, Code: "BACKEND_FAILED", Message: err.Error()})
+		}
+		return
+	}
+
+	meta.DurationMs = time.Since(startedAt).Milliseconds()
+	if !firstTokenAt.IsZero() {
+		meta.FirstTokenMs = firstTokenAt.Sub(startedAt).Milliseconds()
+	}
+	emit(protocol.Event{Type: protocol.EventEnd, Meta: meta})
+}
+
+func (l *local) finish(sessionID string, run *localRun) {
+	run.cancel()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	runs := l.runs[sessionID]
+	for i, r := range runs {
+		if r == run {
+			runs = append(runs[:i], runs[i+1:]...)
+			break
+		}
+	}
+	if len(runs) == 0 {
+		delete(l.runs, sessionID)
+		return
+	}
+	l.runs[sessionID] = runs
+}
@@ -0,0 +1,295 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"openclaw-bridge/connector/pkg/config"
+	"openclaw-bridge/shared/protocol"
+)
+
+// OpenAI fronts an OpenAI-compatible /v1/chat/completions server. It keeps
+// the conversation of every session in memory until the session closes.
+type OpenAI struct {
+	*local
+
+	cfg    config.OpenAIConfig
+	client *http.Client
+
+	mu            sync.Mutex
+	conversations map[string]*conversation
+}
+
+// conversation is the history of one session. Runs of a session take turns,
+// so every request sees the replies to the messages sent before it.
+type conversation struct {
+	turn     chan struct{}
+	messages []chatMessage
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content any    `json:"content"`
+}
+
+type chatRequest struct {
+	Model         string         `json:"model"`
+	Messages      []chatMessage  `json:"messages"`
+	Stream        bool           `json:"stream"`
+	StreamOptions map[string]any `json:"stream_options,omitempty"`
+	MaxTokens     int            `json:"max_tokens,omitempty"`
+	Temperature   *float64       `json:"temperature,omitempty"`
+}
+
+type chatChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int64 `json:"prompt_tokens"`
+		CompletionTokens int64 `json:"completion_tokens"`
+		TotalTokens      int64 `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func NewOpenAI(cfg config.OpenAIConfig, logger *log.Logger, handlers Handlers) *OpenAI {
+	b := &OpenAI{
+		cfg:           cfg,
+		client:        &http.Client{},
+		conversations: map[string]*conversation{},
+	}
+	b.local = newLocal(logger, handlers, time.Duration(cfg.TimeoutSeconds)*time.Second, b.respond)
+	return b
+}
+
+// CloseSession stops the runs of sessionID and forgets its conversation.
+func (b *OpenAI) CloseSession(sessionID string) {
+	b.local.CloseSession(sessionID)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.conversations, sessionID)
+}
+
+// conversation returns the conversation of sessionID, starting one if
+// needed. Runs still holding it after the session closed update a
+// conversation that is no longer reachable.
+func (b *OpenAI) conversation(sessionID string) *conversation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	conv, ok := b.conversations[sessionID]
+	if !ok {
+		conv = &conversation{turn: make(chan struct{}, 1)}
+		b.conversations[sessionID] = conv
+	}
+	return conv
+}
+
+func (b *OpenAI) respond(ctx context.Context, sessionID string, event protocol.Event, emit func(protocol.Event)) (*protocol.RunMeta, error) {
+	user, err := userChatMessage(event)
+	if err != nil {
+		return nil, err
+	}
+
+	conv := b.conversation(sessionID)
+	select {
+	case conv.turn <- struct{}{}:
+		defer func() { <-conv.turn }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	b.mu.Lock()
+	messages := make([]chatMessage, 0, len(conv.messages)+2)
+	if b.cfg.SystemPrompt != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: b.cfg.SystemPrompt})
+	}
+	messages = append(messages, conv.messages...)
+	b.mu.Unlock()
+	messages = append(messages, user)
+
+	body, err := json.Marshal(chatRequest{
+		Model:         b.cfg.Model,
+		Messages:      messages,
+		Stream:        true,
+		StreamOptions: map[string]any{"include_usage": true},
+		MaxTokens:     b.cfg.MaxTokens,
+		Temperature:   b.cfg.Temperature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(b.cfg.BaseURL, "/")+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+	if b.cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.cfg.APIKey)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errorf("OPENAI_UNAVAILABLE", "%v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errorf("OPENAI_REQUEST_FAILED", "status %d: %s", resp.StatusCode, errorMessage(resp.Body))
+	}
+
+	meta := &protocol.RunMeta{Model: b.cfg.Model, Provider: "openai"}
+	var reply strings.Builder
+	streamErr := readSSE(resp.Body, func(data []byte) error {
+		var chunk chatChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return errorf("OPENAI_BAD_STREAM", "invalid chunk: %v", err)
+		}
+		if chunk.Model != "" {
+			meta.Model = chunk.Model
+		}
+		if u := chunk.Usage; u != nil {
+			meta.Usage = &protocol.Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens, TotalTokens: u.TotalTokens}
+		}
+		for _, choice := range chunk.Choices {
+			if text := choice.Delta.ReasoningContent; text != "" {
+				emit(protocol.Event{Type: protocol.EventReasoning, Content: text})
+			}
+			if text := choice.Delta.Content; text != "" {
+				reply.WriteString(text)
+				emit(protocol.Event{Type: protocol.EventToken, Content: text})
+			}
+			if choice.FinishReason != nil && *choice.FinishReason != "" {
+				meta.StopReason = *choice.FinishReason
+			}
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		if reply.Len() > 0 {
+			b.remember(conv, user, reply.String())
+		}
+		return nil, ctx.Err()
+	}
+	if streamErr != nil {
+		if _, ok := streamErr.(*Error); ok {
+			return nil, streamErr
+		}
+		return nil, errorf("OPENAI_BAD_STREAM", "%v", streamErr)
+	}
+	b.remember(conv, user, reply.String())
+	return meta, nil
+}
+
+// remember appends one exchange to conv, keeping at most MaxHistoryMessages
+// messages. Old messages are dropped in user/assistant pairs so the history
+// never starts with a reply.
+func (b *OpenAI) remember(conv *conversation, user chatMessage, reply string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	history := append(conv.messages, user, chatMessage{Role: "assistant", Content: reply})
+	if extra := len(history) - b.cfg.MaxHistoryMessages; extra > 0 {
+		history = history[min(extra+extra%2, len(history)):]
+	}
+	conv.messages = history
+}
+
+// userChatMessage converts a user_message into a chat message, using content
+// parts when it carries images or text files.
+func userChatMessage(event protocol.Event) (chatMessage, error) {
+	if len(event.Images) == 0 && len(event.Files) == 0 {
+		return chatMessage{Role: "user", Content: event.Content}, nil
+	}
+
+	parts := []map[string]any{}
+	if event.Content != "" {
+		parts = append(parts, map[string]any{"type": "text", "text": event.Content})
+	}
+	for _, file := range event.Files {
+		if !strings.HasPrefix(file.MimeType, "text/") && file.MimeType != "application/json" {
+			return chatMessage{}, errorf("OPENAI_UNSUPPORTED_FILE", "%s (%s) cannot be sent to a chat completions backend", file.Name, file.MimeType)
+		}
+		raw, err := base64.StdEncoding.DecodeString(file.Data)
+		if err != nil {
+			return chatMessage{}, errorf("OPENAI_UNSUPPORTED_FILE", "%s: invalid base64 data", file.Name)
+		}
+		parts = append(parts, map[string]any{"type": "text", "text": fmt.Sprintf("File %s:\n%s", file.Name, raw)})
+	}
+	for _, img := range event.Images {
+		parts = append(parts, map[string]any{
+			"type":      "image_url",
+			"image_url": map[string]any{"url": "data:" + img.MimeType + ";base64," + img.Data},
+		})
+	}
+	return chatMessage{Role: "user", Content: parts}, nil
+}
+
+// readSSE calls fn with the data of every server-sent event until the stream
+// ends or sends [DONE].
+func readSSE(r io.Reader, fn func(data []byte) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if data.Len() == 0 {
+				continue
+			}
+			payload := bytes.TrimSpace(data.Bytes())
+			data.Reset()
+			if string(payload) == "[DONE]" {
+				return nil
+			}
+			if err := fn(payload); err != nil {
+				return err
+			}
+			continue
+		}
+		if value, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.Write(bytes.TrimPrefix(value, []byte(" ")))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if payload := bytes.TrimSpace(data.Bytes()); len(payload) > 0 && string(payload) != "[DONE]" {
+		return fn(payload)
+	}
+	return nil
+}
+
+// errorMessage extracts the message of an OpenAI-style error body.
+func errorMessage(r io.Reader) string {
+	raw, _ := io.ReadAll(io.LimitReader(r, 4096))
+	var body struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(raw, &body) == nil && body.Error.Message != "" {
+		return body.Error.Message
+	}
+	return strings.TrimSpace(string(raw))
+}
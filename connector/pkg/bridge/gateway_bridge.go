@@ -1,10 +1,17 @@
 package bridge
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"openclaw-bridge/connector/pkg/attachments"
+	"openclaw-bridge/connector/pkg/images"
 	"openclaw-bridge/shared/protocol"
 )
 
@@ -14,52 +21,157 @@ type RelaySender interface {
 
 type GatewaySender interface {
 	SendUserMessage(sessionID string, event protocol.Event) error
-	SendCancel(sessionID string) error
+	SendCancel(sessionID, eventID string) error
 	IsReady() bool
 }
 
+// SessionCloser is implemented by backends that keep per-session state.
+type SessionCloser interface {
+	CloseSession(sessionID string)
+}
+
 type sessionState struct {
 	flags byte
+	caps  *protocol.Caps
+	usage sessionUsage
+}
+
+// sessionUsage accumulates run accounting for a session until it closes.
+type sessionUsage struct {
+	runs         int
+	inputTokens  int64
+	outputTokens int64
+	totalTokens  int64
 }
 
+// Options tunes GatewayBridge behaviour.
+type Options struct {
+	// StrictRouting drops gateway events without a session id instead of
+	// delivering them to the only open session.
+	StrictRouting bool
+	// PendingQueueSize bounds how many user_message events are held while
+	// the gateway is reconnecting. Zero or negative disables queueing.
+	PendingQueueSize int
+	// PendingTimeout is how long a queued message may wait for the gateway.
+	PendingTimeout time.Duration
+	// Attachments bounds binary attachment uploads.
+	Attachments attachments.Limits
+	// Images validates and normalises user_message images.
+	Images images.Limits
+	// InlineMediaBytes is the largest media item sent as base64 inside the
+	// media event; bigger items are streamed as attachment chunks.
+	InlineMediaBytes int64
+}
+
+// GatewayBridge connects relay sessions to a backend: the OpenClaw gateway
+// or any other GatewaySender, such as the local backends in package backend.
 type GatewayBridge struct {
 	logger  *log.Logger
 	relay   RelaySender
 	gateway GatewaySender
+	opts    Options
+
+	mu           sync.RWMutex
+	sessions     map[string]sessionState
+	reconnecting bool
+
+	pendingMu sync.Mutex
+	pending   []*pendingMessage
+	flushMu   sync.Mutex
 
-	mu       sync.RWMutex
-	sessions map[string]sessionState
+	inboxMu sync.Mutex
+	inboxes map[string]*sessionInbox
+
+	attachments *attachments.Store
+
+	droppedEvents atomic.Int64
+	mediaSeq      atomic.Int64
 }
 
-func NewGatewayBridge(logger *log.Logger, relay RelaySender) *GatewayBridge {
+func NewGatewayBridge(logger *log.Logger, relay RelaySender, opts Options) *GatewayBridge {
 	return &GatewayBridge{
 		logger:   logger,
 		relay:    relay,
+		opts:     opts,
 		sessions: make(map[string]sessionState),
+		inboxes:  make(map[string]*sessionInbox),
+
+		attachments: attachments.NewStore(opts.Attachments),
 	}
 }
 
+// Run drops idle attachment uploads until ctx is done.
+func (b *GatewayBridge) Run(ctx context.Context) {
+	b.attachments.Run(ctx)
+}
+
 func (b *GatewayBridge) BindGateway(gateway GatewaySender) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.gateway = gateway
 }
 
-func (b *GatewayBridge) OpenSession(sessionID string) {
+// OpenSession registers a session. caps are the capabilities negotiated in
+// SESSION_OPEN: they select which optional events the session receives,
+// whether media is streamed as attachments and the largest frame to send.
+func (b *GatewayBridge) OpenSession(sessionID string, caps *protocol.Caps) {
+	if caps == nil {
+		caps = &protocol.Caps{}
+	}
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	if _, ok := b.sessions[sessionID]; !ok {
-		b.sessions[sessionID] = sessionState{}
+		b.sessions[sessionID] = sessionState{caps: caps}
 	}
 }
 
 func (b *GatewayBridge) CloseSession(sessionID string) {
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	state, ok := b.sessions[sessionID]
 	delete(b.sessions, sessionID)
+	gateway := b.gateway
+	b.mu.Unlock()
+	b.dropInbox(sessionID)
+	b.dropPending(sessionID, "")
+	if closer, ok := gateway.(SessionCloser); ok {
+		closer.CloseSession(sessionID)
+	}
+	b.attachments.DropSession(sessionID)
+
+	if ok && state.usage.runs > 0 {
+		u := state.usage
+		b.logger.Printf("session usage sid=%s runs=%d input_tokens=%d output_tokens=%d total_tokens=%d", sessionID, u.runs, u.inputTokens, u.outputTokens, u.totalTokens)
+	}
+}
+
+func (b *GatewayBridge) sessionOpen(sessionID string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.sessions[sessionID]
+	return ok
 }
 
 func (b *GatewayBridge) HandleData(sessionID string, flags byte, payload []byte) {
+	if flags&protocol.FlagCompressed != 0 {
+		b.mu.RLock()
+		state, ok := b.sessions[sessionID]
+		b.mu.RUnlock()
+		flags &^= protocol.FlagCompressed
+		if !ok {
+			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "SESSION_NOT_OPEN", Message: "session not open"})
+			return
+		}
+		var err error
+		if _, payload, err = protocol.DecompressPayload(state.caps.CompressionAlgorithm(), protocol.FlagCompressed, payload, state.caps.MaxFrameSize); err != nil {
+			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "BAD_COMPRESSION", Message: err.Error()})
+			return
+		}
+	}
+	if flags&protocol.FlagAttachment != 0 {
+		b.handleAttachmentChunk(sessionID, flags&^protocol.FlagAttachment, payload)
+		return
+	}
+
 	event, err := protocol.DecodeEvent(payload)
 	if err != nil {
 		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "BAD_EVENT", Message: "invalid event payload"})
@@ -79,78 +191,297 @@ func (b *GatewayBridge) HandleData(sessionID string, flags byte, payload []byte)
 	b.mu.Unlock()
 
 	if gateway == nil {
-		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_NOT_CONFIGURED", Message: "gateway client not configured"})
+		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "GATEWAY_NOT_CONFIGURED", Message: "gateway client not configured"})
+		return
+	}
+	// Resolving attachments and normalising images can take a while, so
+	// events run on a per-session goroutine instead of the relay read loop.
+	if !b.dispatch(sessionID, func() { b.handleEvent(gateway, sessionID, flags, event) }) {
+		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "SESSION_BUSY", Message: "too many events waiting for this session"})
+	}
+}
+
+// handleEvent forwards a decoded client event to the gateway.
+func (b *GatewayBridge) handleEvent(gateway GatewaySender, sessionID string, flags byte, event protocol.Event) {
+	if !b.sessionOpen(sessionID) {
 		return
 	}
+	if len(event.Attachments) > 0 {
+		if err := b.resolveAttachments(sessionID, &event); err != nil {
+			b.sendRejection(sessionID, flags, event.ID, err)
+			return
+		}
+	}
+	if len(event.Images) > 0 {
+		normalized, err := images.Normalize(event.Images, b.opts.Images)
+		if err != nil {
+			b.sendRejection(sessionID, flags, event.ID, err)
+			return
+		}
+		event.Images = normalized
+	}
 	if !gateway.IsReady() {
-		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_NOT_READY", Message: "gateway not ready"})
+		b.handleNotReady(gateway, sessionID, flags, event)
 		return
 	}
 
 	switch event.Type {
 	case protocol.EventUserMessage:
 		if err := gateway.SendUserMessage(sessionID, event); err != nil {
-			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_SEND_FAILED", Message: err.Error()})
+			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "GATEWAY_SEND_FAILED", Message: err.Error()})
 		}
 	case "control":
 		if event.Action != "stop" {
-			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "UNSUPPORTED_CONTROL", Message: "unsupported control action"})
+			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "UNSUPPORTED_CONTROL", Message: "unsupported control action"})
 			return
 		}
-		if err := gateway.SendCancel(sessionID); err != nil {
-			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_CANCEL_FAILED", Message: err.Error()})
+		if err := gateway.SendCancel(sessionID, event.ID); err != nil {
+			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "GATEWAY_CANCEL_FAILED", Message: err.Error()})
 		}
 	default:
-		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "UNSUPPORTED_EVENT", Message: "unsupported event type"})
+		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "UNSUPPORTED_EVENT", Message: "unsupported event type"})
+	}
+}
+
+func (b *GatewayBridge) handleAttachmentChunk(sessionID string, flags byte, payload []byte) {
+	if !b.sessionOpen(sessionID) {
+		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "SESSION_NOT_OPEN", Message: "session not open"})
+		return
+	}
+	chunk, err := protocol.DecodeAttachmentChunk(payload)
+	if err != nil {
+		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, Code: "BAD_ATTACHMENT", Message: err.Error()})
+		return
+	}
+	if err := b.attachments.AddChunk(sessionID, chunk); err != nil {
+		b.sendRejection(sessionID, flags, chunk.ID, err)
+	}
+}
+
+// resolveAttachments replaces the attachment refs of event with the uploaded
+// content, as inline images or files.
+func (b *GatewayBridge) resolveAttachments(sessionID string, event *protocol.Event) error {
+	for _, ref := range event.Attachments {
+		file, err := b.attachments.Take(sessionID, ref)
+		if err != nil {
+			return err
+		}
+		data := base64.StdEncoding.EncodeToString(file.Data)
+		if file.IsImage() {
+			event.Images = append(event.Images, protocol.ImageItem{Data: data, MimeType: file.MimeType})
+			continue
+		}
+		event.Files = append(event.Files, protocol.FileItem{Data: data, MimeType: file.MimeType, Name: file.Name})
+	}
+	event.Attachments = nil
+	return nil
+}
+
+// sendRejection reports an attachment or image validation failure with its
+// precise error code. id is the user_message id, or the attachment id for
+// failed chunks.
+func (b *GatewayBridge) sendRejection(sessionID string, flags byte, id string, err error) {
+	event := protocol.Event{Type: protocol.EventError, ID: id, Code: "BAD_ATTACHMENT", Message: err.Error()}
+	var attErr *attachments.Error
+	var imgErr *images.Error
+	switch {
+	case errors.As(err, &attErr):
+		event.Code, event.Message = attErr.Code, attErr.Message
+	case errors.As(err, &imgErr):
+		event.Code, event.Message = imgErr.Code, imgErr.Message
+	}
+	b.sendEvent(sessionID, flags, event)
+}
+
+// handleNotReady queues user messages and resolves stops against the queue
+// while the gateway is unavailable.
+func (b *GatewayBridge) handleNotReady(gateway GatewaySender, sessionID string, flags byte, event protocol.Event) {
+	switch {
+	case event.Type == protocol.EventUserMessage:
+		if !b.enqueuePending(sessionID, flags, event) {
+			b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "GATEWAY_NOT_READY", Message: "gateway not ready and pending queue is full"})
+			return
+		}
+		b.sendStatus(sessionID, flags, event.ID, StatusGatewayReconnecting)
+		// The gateway may have become ready, and flushed the queue, between
+		// the readiness check and the enqueue.
+		if gateway.IsReady() {
+			b.flushPending(gateway)
+		}
+	case event.Type == "control" && event.Action == "stop":
+		for _, p := range b.dropPending(sessionID, event.ID) {
+			b.sendEvent(p.sessionID, p.flags, protocol.Event{Type: protocol.EventEnd, ID: p.event.ID})
+		}
+	default:
+		b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "GATEWAY_NOT_READY", Message: "gateway not ready"})
 	}
 }
 
 func (b *GatewayBridge) HandleGatewayEvent(sessionID string, event protocol.Event) {
-	sid, flags, ok := b.resolveSession(sessionID)
+	sid, state, ok := b.resolveSession(sessionID)
 	if !ok {
-		b.logger.Printf("drop gateway event without active session type=%s", event.Type)
+		dropped := b.droppedEvents.Add(1)
+		b.logger.Printf("drop gateway event without active session type=%s sid=%s dropped_total=%d", event.Type, sessionID, dropped)
+		return
+	}
+	if event.Type == protocol.EventEnd {
+		b.recordRun(sid, event)
+	}
+	if !state.caps.AcceptsEvent(event.Type) {
 		return
 	}
-	b.sendEvent(sid, flags, event)
+	if event.Type == protocol.EventMedia && event.Media != nil && event.Media.Size > b.opts.InlineMediaBytes && state.caps.Attachments {
+		if err := b.streamMedia(sid, state.flags, &event); err != nil {
+			b.logger.Printf("media stream error sid=%s err=%v", sid, err)
+			b.sendEvent(sid, state.flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "MEDIA_STREAM_FAILED", Message: err.Error()})
+			return
+		}
+	}
+	if limit := state.caps.MaxFrameSize; limit > 0 {
+		// The relay drops connections that exceed the negotiated limit,
+		// which would take every other session down with this one.
+		if payload, err := protocol.EncodeEvent(event); err == nil && 2+len(sid)+len(payload) > limit {
+			b.logger.Printf("drop oversized event sid=%s type=%s bytes=%d max_frame_size=%d", sid, event.Type, len(payload), limit)
+			b.sendEvent(sid, state.flags, protocol.Event{Type: protocol.EventError, ID: event.ID, Code: "FRAME_TOO_LARGE",
+				Message: fmt.Sprintf("%s event exceeds max_frame_size %d", event.Type, limit)})
+			return
+		}
+	}
+	b.sendEvent(sid, state.flags, event)
 }
 
+// streamMedia sends the inline data of a media event as attachment chunks
+// and rewrites the event to reference them.
+func (b *GatewayBridge) streamMedia(sessionID string, flags byte, event *protocol.Event) error {
+	raw, err := base64.StdEncoding.DecodeString(event.Media.Data)
+	if err != nil {
+		return err
+	}
+
+	media := *event.Media
+	media.Data = ""
+	media.AttachmentID = fmt.Sprintf("m%d", b.mediaSeq.Add(1))
+	for _, chunk := range protocol.SplitAttachment(media.AttachmentID, raw, protocol.DefaultAttachmentChunkSize) {
+		payload, err := protocol.EncodeAttachmentChunk(chunk)
+		if err != nil {
+			return err
+		}
+		if err := b.sendData(sessionID, flags|protocol.FlagAttachment, payload); err != nil {
+			return err
+		}
+	}
+	event.Media = &media
+	return nil
+}
+
+// recordRun logs the metadata of a finished run and adds its usage to the
+// session totals.
+func (b *GatewayBridge) recordRun(sessionID string, event protocol.Event) {
+	meta := event.Meta
+	if meta == nil {
+		meta = &protocol.RunMeta{}
+	}
+	usage := meta.Usage
+	if usage == nil {
+		usage = &protocol.Usage{}
+	}
+	b.logger.Printf(
+		"run end sid=%s id=%s run_id=%s model=%s stop_reason=%s input_tokens=%d output_tokens=%d total_tokens=%d duration_ms=%d first_token_ms=%d",
+		sessionID, event.ID, meta.RunID, meta.Model, meta.StopReason,
+		usage.InputTokens, usage.OutputTokens, usage.TotalTokens, meta.DurationMs, meta.FirstTokenMs,
+	)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.sessions[sessionID]
+	if !ok {
+		return
+	}
+	state.usage.runs++
+	state.usage.inputTokens += usage.InputTokens
+	state.usage.outputTokens += usage.OutputTokens
+	state.usage.totalTokens += usage.TotalTokens
+	b.sessions[sessionID] = state
+}
+
+// DroppedEvents reports how many gateway events could not be routed to an
+// open session.
+func (b *GatewayBridge) DroppedEvents() int64 {
+	return b.droppedEvents.Load()
+}
+
+// HandleGatewayDisconnected tells every session that the gateway is
+// reconnecting. Runs lost with the connection are failed by the gateway
+// client itself; new messages are queued until HandleGatewayReady.
 func (b *GatewayBridge) HandleGatewayDisconnected(err error) {
+	b.mu.Lock()
+	b.reconnecting = true
+	b.mu.Unlock()
+
+	b.logger.Printf("gateway reconnecting err=%v", err)
+	b.broadcastStatus(StatusGatewayReconnecting)
+}
+
+// HandleGatewayReady flushes messages queued during a reconnect.
+func (b *GatewayBridge) HandleGatewayReady() {
+	b.mu.Lock()
+	wasReconnecting := b.reconnecting
+	b.reconnecting = false
+	gateway := b.gateway
+	b.mu.Unlock()
+
+	if wasReconnecting {
+		b.broadcastStatus(StatusGatewayReady)
+	}
+	if gateway != nil {
+		b.flushPending(gateway)
+	}
+}
+
+func (b *GatewayBridge) broadcastStatus(status string) {
 	b.mu.RLock()
-	active := make([]struct {
-		sessionID string
-		flags     byte
-	}, 0, len(b.sessions))
+	active := make(map[string]byte, len(b.sessions))
 	for sid, state := range b.sessions {
-		active = append(active, struct {
-			sessionID string
-			flags     byte
-		}{sessionID: sid, flags: state.flags})
+		if state.caps.AcceptsEvent(protocol.EventStatus) {
+			active[sid] = state.flags
+		}
 	}
 	b.mu.RUnlock()
 
-	for _, s := range active {
-		b.sendEvent(s.sessionID, s.flags, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_DISCONNECTED", Message: fmt.Sprintf("gateway disconnected: %v", err)})
+	for sid, flags := range active {
+		b.sendEvent(sid, flags, protocol.Event{Type: protocol.EventStatus, Status: status})
 	}
 }
 
-func (b *GatewayBridge) resolveSession(sessionID string) (resolvedSessionID string, flags byte, ok bool) {
+// sendStatus sends a status event to a session that opted into them.
+func (b *GatewayBridge) sendStatus(sessionID string, flags byte, eventID, status string) {
+	b.mu.RLock()
+	state, ok := b.sessions[sessionID]
+	b.mu.RUnlock()
+	if !ok || !state.caps.AcceptsEvent(protocol.EventStatus) {
+		return
+	}
+	b.sendEvent(sessionID, flags, protocol.Event{Type: protocol.EventStatus, ID: eventID, Status: status})
+}
+
+func (b *GatewayBridge) resolveSession(sessionID string) (resolvedSessionID string, state sessionState, ok bool) {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
 	if sessionID != "" {
 		state, exists := b.sessions[sessionID]
 		if exists {
-			return sessionID, state.flags, true
+			return sessionID, state, true
 		}
-		return "", 0, false
+		return "", sessionState{}, false
 	}
 
-	if len(b.sessions) == 1 {
+	if !b.opts.StrictRouting && len(b.sessions) == 1 {
 		for sid, state := range b.sessions {
-			return sid, state.flags, true
+			return sid, state, true
 		}
 	}
-	return "", 0, false
+	return "", sessionState{}, false
 }
 
 func (b *GatewayBridge) sendEvent(sessionID string, flags byte, event protocol.Event) {
@@ -159,7 +490,17 @@ func (b *GatewayBridge) sendEvent(sessionID string, flags byte, event protocol.E
 		b.logger.Printf("encode event error sid=%s err=%v", sessionID, err)
 		return
 	}
-	if err := b.relay.SendData(sessionID, flags, payload); err != nil {
+	if err := b.sendData(sessionID, flags, payload); err != nil {
 		b.logger.Printf("relay send error sid=%s err=%v", sessionID, err)
 	}
 }
+
+// sendData sends a DATA frame, compressed if the session negotiated payload
+// compression and it pays off.
+func (b *GatewayBridge) sendData(sessionID string, flags byte, payload []byte) error {
+	b.mu.RLock()
+	state := b.sessions[sessionID]
+	b.mu.RUnlock()
+	flags, payload = protocol.CompressPayload(state.caps.CompressionAlgorithm(), flags, payload)
+	return b.relay.SendData(sessionID, flags, payload)
+}
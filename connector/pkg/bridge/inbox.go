@@ -0,0 +1,61 @@
+package bridge
+
+// maxQueuedEvents bounds the events of one session waiting behind a slow
+// one, such as a message whose images are being normalised.
+const maxQueuedEvents = 64
+
+// sessionInbox runs the events of one session in arrival order. Its
+// goroutine exits once the inbox is empty.
+type sessionInbox struct {
+	pending []func()
+	running bool
+}
+
+// dispatch queues fn behind the earlier events of the session. It reports
+// false when too many events are already waiting.
+func (b *GatewayBridge) dispatch(sessionID string, fn func()) bool {
+	b.inboxMu.Lock()
+	defer b.inboxMu.Unlock()
+	in := b.inboxes[sessionID]
+	if in == nil {
+		in = &sessionInbox{}
+		b.inboxes[sessionID] = in
+	}
+	if len(in.pending) >= maxQueuedEvents {
+		return false
+	}
+	in.pending = append(in.pending, fn)
+	if !in.running {
+		in.running = true
+		go b.drainInbox(sessionID, in)
+	}
+	return true
+}
+
+func (b *GatewayBridge) drainInbox(sessionID string, in *sessionInbox) {
+	for {
+		b.inboxMu.Lock()
+		if len(in.pending) == 0 {
+			in.running = false
+			if b.inboxes[sessionID] == in {
+				delete(b.inboxes, sessionID)
+			}
+			b.inboxMu.Unlock()
+			return
+		}
+		fn := in.pending[0]
+		in.pending = in.pending[1:]
+		b.inboxMu.Unlock()
+		fn()
+	}
+}
+
+// dropInbox discards the events a closed session still had waiting.
+func (b *GatewayBridge) dropInbox(sessionID string) {
+	b.inboxMu.Lock()
+	defer b.inboxMu.Unlock()
+	if in := b.inboxes[sessionID]; in != nil {
+		in.pending = nil
+		delete(b.inboxes, sessionID)
+	}
+}
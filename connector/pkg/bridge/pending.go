@@ -0,0 +1,101 @@
+package bridge
+
+import (
+	"time"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+const (
+	StatusGatewayReconnecting = "gateway_reconnecting"
+	StatusGatewayReady        = "gateway_ready"
+)
+
+// pendingMessage is a user_message held while the gateway is reconnecting.
+type pendingMessage struct {
+	sessionID string
+	flags     byte
+	event     protocol.Event
+	timer     *time.Timer
+}
+
+// enqueuePending holds event until the gateway is ready again. It reports
+// false when the queue is full or queueing is disabled.
+func (b *GatewayBridge) enqueuePending(sessionID string, flags byte, event protocol.Event) bool {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	if len(b.pending) >= b.opts.PendingQueueSize {
+		return false
+	}
+
+	p := &pendingMessage{sessionID: sessionID, flags: flags, event: event}
+	p.timer = time.AfterFunc(b.opts.PendingTimeout, func() {
+		if b.removePending(p) {
+			b.sendEvent(p.sessionID, p.flags, protocol.Event{Type: protocol.EventError, ID: p.event.ID, Code: "GATEWAY_QUEUE_TIMEOUT", Message: "gateway did not reconnect in time"})
+		}
+	})
+	b.pending = append(b.pending, p)
+	return true
+}
+
+func (b *GatewayBridge) removePending(p *pendingMessage) bool {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	for i, q := range b.pending {
+		if q == p {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// dropPending removes the queued messages of a session. An empty eventID
+// matches every message of the session.
+func (b *GatewayBridge) dropPending(sessionID, eventID string) []*pendingMessage {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	var dropped []*pendingMessage
+	kept := b.pending[:0]
+	for _, p := range b.pending {
+		if p.sessionID == sessionID && (eventID == "" || p.event.ID == eventID) {
+			p.timer.Stop()
+			dropped = append(dropped, p)
+			continue
+		}
+		kept = append(kept, p)
+	}
+	b.pending = kept
+	return dropped
+}
+
+func (b *GatewayBridge) popPending() (*pendingMessage, bool) {
+	b.pendingMu.Lock()
+	defer b.pendingMu.Unlock()
+	if len(b.pending) == 0 {
+		return nil, false
+	}
+	p := b.pending[0]
+	b.pending = b.pending[1:]
+	p.timer.Stop()
+	return p, true
+}
+
+// flushPending forwards queued messages in arrival order for as long as the
+// gateway stays ready. Concurrent flushes are serialised to keep that order.
+func (b *GatewayBridge) flushPending(gateway GatewaySender) {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+	for gateway.IsReady() {
+		p, ok := b.popPending()
+		if !ok {
+			return
+		}
+		if !b.sessionOpen(p.sessionID) {
+			continue
+		}
+		if err := gateway.SendUserMessage(p.sessionID, p.event); err != nil {
+			b.sendEvent(p.sessionID, p.flags, protocol.Event{Type: protocol.EventError, ID: p.event.ID, Code: "GATEWAY_SEND_FAILED", Message: err.Error()})
+		}
+	}
+}
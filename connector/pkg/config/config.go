@@ -8,24 +8,91 @@ import (
 	"openclaw-bridge/shared/protocol"
 )
 
+// Backend modes selectable with the "mode" key.
+const (
+	ModeGateway = "gateway"
+	ModeEcho    = "echo"
+	ModeOpenAI  = "openai"
+	ModeExec    = "exec"
+)
+
 type Config struct {
-	RelayURL       string        `json:"relay_url"`
-	AccessCode     string        `json:"access_code"`
-	AccessCodeHash string        `json:"access_code_hash"`
-	Gateway        GatewayConfig `json:"gateway"`
+	RelayURL       string           `json:"relay_url"`
+	AccessCode     string           `json:"access_code"`
+	AccessCodeHash string           `json:"access_code_hash"`
+	Mode           string           `json:"mode"`
+	Gateway        GatewayConfig    `json:"gateway"`
+	OpenAI         OpenAIConfig     `json:"openai"`
+	Exec           ExecConfig       `json:"exec"`
+	Attachments    AttachmentConfig `json:"attachments"`
+	Images         ImageConfig      `json:"images"`
+}
+
+// OpenAIConfig configures the openai backend. BaseURL includes the version
+// prefix, e.g. http://127.0.0.1:8000/v1.
+type OpenAIConfig struct {
+	BaseURL            string   `json:"base_url"`
+	APIKey             string   `json:"api_key"`
+	Model              string   `json:"model"`
+	SystemPrompt       string   `json:"system_prompt"`
+	MaxTokens          int      `json:"max_tokens"`
+	Temperature        *float64 `json:"temperature"`
+	MaxHistoryMessages int      `json:"max_history_messages"`
+	TimeoutSeconds     int      `json:"timeout_seconds"`
+}
+
+// ExecConfig configures the exec backend, which runs Command once per
+// message.
+type ExecConfig struct {
+	Command        []string `json:"command"`
+	Dir            string   `json:"dir"`
+	Env            []string `json:"env"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+type ImageConfig struct {
+	MaxBytes     int64    `json:"max_bytes"`
+	MaxWidth     int      `json:"max_width"`
+	MaxHeight    int      `json:"max_height"`
+	MaxCount     int      `json:"max_count"`
+	AllowedTypes []string `json:"allowed_types"`
+	Downscale    bool     `json:"downscale"`
+	Reencode     string   `json:"reencode"`
+	JPEGQuality  int      `json:"jpeg_quality"`
+}
+
+type AttachmentConfig struct {
+	MaxBytes           int64    `json:"max_bytes"`
+	MaxPerSession      int      `json:"max_per_session"`
+	AllowedTypes       []string `json:"allowed_types"`
+	IdleTimeoutSeconds int      `json:"idle_timeout_seconds"`
+	InlineMediaBytes   int64    `json:"inline_media_bytes"`
 }
 
 type GatewayConfig struct {
-	URL                     string            `json:"url"`
-	Auth                    GatewayAuthConfig `json:"auth"`
-	MinProtocol             int               `json:"min_protocol"`
-	MaxProtocol             int               `json:"max_protocol"`
-	Scopes                  []string          `json:"scopes"`
-	Locale                  string            `json:"locale"`
-	UserAgent               string            `json:"user_agent"`
-	ChallengeTimeoutSeconds int               `json:"challenge_timeout_seconds"`
-	ReconnectInitialSeconds int               `json:"reconnect_initial_seconds"`
-	ReconnectMaxSeconds     int               `json:"reconnect_max_seconds"`
+	URL                      string            `json:"url"`
+	Auth                     GatewayAuthConfig `json:"auth"`
+	MinProtocol              int               `json:"min_protocol"`
+	MaxProtocol              int               `json:"max_protocol"`
+	Scopes                   []string          `json:"scopes"`
+	Locale                   string            `json:"locale"`
+	UserAgent                string            `json:"user_agent"`
+	ChallengeTimeoutSeconds  int               `json:"challenge_timeout_seconds"`
+	ReconnectInitialSeconds  int               `json:"reconnect_initial_seconds"`
+	ReconnectMaxSeconds      int               `json:"reconnect_max_seconds"`
+	StrictRouting            *bool             `json:"strict_routing"`
+	LogUnmatchedEvents       bool              `json:"log_unmatched_events"`
+	RunTTLSeconds            int               `json:"run_ttl_seconds"`
+	FirstTokenTimeoutSeconds int               `json:"first_token_timeout_seconds"`
+	RunTimeoutSeconds        int               `json:"run_timeout_seconds"`
+	PendingQueueSize         int               `json:"pending_queue_size"`
+	PendingTimeoutSeconds    int               `json:"pending_timeout_seconds"`
+}
+
+// Strict reports whether uncorrelated gateway events are dropped rather than
+// delivered to a fallback session. It is on unless strict_routing is false.
+func (g GatewayConfig) Strict() bool {
+	return g.StrictRouting == nil || *g.StrictRouting
 }
 
 type GatewayAuthConfig struct {
@@ -52,6 +119,31 @@ func Load(path string) (Config, error) {
 		}
 		cfg.AccessCodeHash = protocol.HashAccessCode(cfg.AccessCode)
 	}
+	switch cfg.Mode {
+	case "":
+		cfg.Mode = ModeGateway
+	case ModeGateway, ModeEcho, ModeOpenAI, ModeExec:
+	default:
+		return Config{}, fmt.Errorf("mode must be one of %q, %q, %q, %q", ModeGateway, ModeEcho, ModeOpenAI, ModeExec)
+	}
+	if cfg.Mode == ModeExec && len(cfg.Exec.Command) == 0 {
+		return Config{}, fmt.Errorf("exec.command is required in exec mode")
+	}
+	if cfg.Mode == ModeOpenAI && cfg.OpenAI.Model == "" {
+		return Config{}, fmt.Errorf("openai.model is required in openai mode")
+	}
+	if cfg.OpenAI.BaseURL == "" {
+		cfg.OpenAI.BaseURL = "http://127.0.0.1:8000/v1"
+	}
+	if cfg.OpenAI.MaxHistoryMessages <= 0 {
+		cfg.OpenAI.MaxHistoryMessages = 40
+	}
+	if cfg.OpenAI.TimeoutSeconds <= 0 {
+		cfg.OpenAI.TimeoutSeconds = 600
+	}
+	if cfg.Exec.TimeoutSeconds <= 0 {
+		cfg.Exec.TimeoutSeconds = 600
+	}
 	if cfg.Gateway.URL == "" {
 		cfg.Gateway.URL = "ws://127.0.0.1:18789"
 	}
@@ -79,6 +171,57 @@ func Load(path string) (Config, error) {
 	if cfg.Gateway.ReconnectMaxSeconds <= 0 {
 		cfg.Gateway.ReconnectMaxSeconds = 30
 	}
+	if cfg.Gateway.FirstTokenTimeoutSeconds <= 0 {
+		cfg.Gateway.FirstTokenTimeoutSeconds = 60
+	}
+	if cfg.Gateway.RunTimeoutSeconds <= 0 {
+		cfg.Gateway.RunTimeoutSeconds = 600
+	}
+	if cfg.Gateway.PendingQueueSize == 0 {
+		cfg.Gateway.PendingQueueSize = 32
+	}
+	if cfg.Gateway.PendingTimeoutSeconds <= 0 {
+		cfg.Gateway.PendingTimeoutSeconds = 30
+	}
+	if cfg.Gateway.RunTTLSeconds <= 0 {
+		cfg.Gateway.RunTTLSeconds = cfg.Gateway.RunTimeoutSeconds + 60
+	}
+	if cfg.Gateway.RunTTLSeconds <= cfg.Gateway.RunTimeoutSeconds {
+		return Config{}, fmt.Errorf("gateway.run_ttl_seconds (%d) must exceed gateway.run_timeout_seconds (%d)", cfg.Gateway.RunTTLSeconds, cfg.Gateway.RunTimeoutSeconds)
+	}
+
+	if cfg.Attachments.MaxBytes <= 0 {
+		cfg.Attachments.MaxBytes = 20 << 20
+	}
+	if cfg.Attachments.MaxPerSession <= 0 {
+		cfg.Attachments.MaxPerSession = 8
+	}
+	if cfg.Attachments.IdleTimeoutSeconds <= 0 {
+		cfg.Attachments.IdleTimeoutSeconds = 120
+	}
+	if cfg.Attachments.InlineMediaBytes <= 0 {
+		cfg.Attachments.InlineMediaBytes = 256 << 10
+	}
+	if cfg.Images.MaxBytes <= 0 {
+		cfg.Images.MaxBytes = 5 << 20
+	}
+	if cfg.Images.MaxWidth <= 0 {
+		cfg.Images.MaxWidth = 4096
+	}
+	if cfg.Images.MaxHeight <= 0 {
+		cfg.Images.MaxHeight = 4096
+	}
+	if cfg.Images.MaxCount <= 0 {
+		cfg.Images.MaxCount = 8
+	}
+	switch cfg.Images.Reencode {
+	case "", "png", "jpeg":
+	default:
+		return Config{}, fmt.Errorf("images.reencode must be \"png\", \"jpeg\" or empty")
+	}
+	if cfg.Images.JPEGQuality <= 0 || cfg.Images.JPEGQuality > 100 {
+		cfg.Images.JPEGQuality = 85
+	}
 
 	return cfg, nil
 }
@@ -0,0 +1,149 @@
+// Package connector wires a relay client, the bridge and the backend selected
+// by the config into one running connector. The connector binary, the e2e
+// harness and the CLI bench all build it the same way.
+package connector
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"openclaw-bridge/connector/pkg/attachments"
+	"openclaw-bridge/connector/pkg/backend"
+	"openclaw-bridge/connector/pkg/bridge"
+	"openclaw-bridge/connector/pkg/config"
+	"openclaw-bridge/connector/pkg/images"
+	"openclaw-bridge/connector/pkg/relayclient"
+	"openclaw-bridge/shared/protocol"
+)
+
+// Options are hooks for callers that embed a connector.
+type Options struct {
+	// OnControl is called with every control message from the relay,
+	// after the bridge has handled it.
+	OnControl func(msg protocol.ControlMessage)
+}
+
+type Connector struct {
+	logger *log.Logger
+	bridge *bridge.GatewayBridge
+	relay  *relayclient.Client
+	agent  backend.Backend
+}
+
+// New builds a connector for cfg. It does not connect until Run.
+func New(cfg config.Config, logger *log.Logger, opts Options) (*Connector, error) {
+	c := &Connector{logger: logger}
+	c.relay = relayclient.New(cfg, logger,
+		func(msg protocol.ControlMessage) {
+			switch msg.Type {
+			case protocol.TypeSessionOpen:
+				c.bridge.OpenSession(msg.SessionID, msg.Caps)
+				logger.Printf("session open sid=%s", msg.SessionID)
+			case protocol.TypeCloseSession:
+				c.bridge.CloseSession(msg.SessionID)
+				logger.Printf("session close sid=%s", msg.SessionID)
+			case protocol.TypeError:
+				logger.Printf("relay error code=%s message=%s", msg.Code, msg.Message)
+			}
+			if opts.OnControl != nil {
+				opts.OnControl(msg)
+			}
+		},
+		func(sessionID string, flags byte, payload []byte) {
+			c.bridge.HandleData(sessionID, flags, payload)
+		},
+	)
+	c.bridge = bridge.NewGatewayBridge(logger, c.relay, BridgeOptions(cfg))
+
+	agent, err := backend.New(cfg, logger, backend.Handlers{
+		OnEvent: func(sessionID string, event protocol.Event) {
+			c.bridge.HandleGatewayEvent(sessionID, event)
+		},
+		OnDisconnected: func(err error) {
+			c.bridge.HandleGatewayDisconnected(err)
+		},
+		OnReady: func() {
+			logger.Printf("backend ready mode=%s", cfg.Mode)
+			c.bridge.HandleGatewayReady()
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.agent = agent
+	c.bridge.BindGateway(agent)
+	return c, nil
+}
+
+// BridgeOptions translates the bridge settings of cfg.
+func BridgeOptions(cfg config.Config) bridge.Options {
+	return bridge.Options{
+		StrictRouting:    cfg.Gateway.Strict(),
+		PendingQueueSize: cfg.Gateway.PendingQueueSize,
+		PendingTimeout:   time.Duration(cfg.Gateway.PendingTimeoutSeconds) * time.Second,
+		Attachments: attachments.Limits{
+			MaxBytes:      cfg.Attachments.MaxBytes,
+			MaxPerSession: cfg.Attachments.MaxPerSession,
+			AllowedTypes:  cfg.Attachments.AllowedTypes,
+			IdleTimeout:   time.Duration(cfg.Attachments.IdleTimeoutSeconds) * time.Second,
+		},
+		Images: images.Limits{
+			MaxBytes:     cfg.Images.MaxBytes,
+			MaxWidth:     cfg.Images.MaxWidth,
+			MaxHeight:    cfg.Images.MaxHeight,
+			MaxCount:     cfg.Images.MaxCount,
+			AllowedTypes: cfg.Images.AllowedTypes,
+			Downscale:    cfg.Images.Downscale,
+			Reencode:     cfg.Images.Reencode,
+			JPEGQuality:  cfg.Images.JPEGQuality,
+		},
+		InlineMediaBytes: cfg.Attachments.InlineMediaBytes,
+	}
+}
+
+// DroppedEvents reports how many backend events were dropped: those the
+// gateway client could not correlate with a session, and those for sessions
+// that are no longer open.
+func (c *Connector) DroppedEvents() int64 {
+	n := c.bridge.DroppedEvents()
+	if counter, ok := c.agent.(interface{ DroppedEvents() int64 }); ok {
+		n += counter.DroppedEvents()
+	}
+	return n
+}
+
+// Run serves until ctx is cancelled or the relay client or backend fails,
+// and returns the first failure.
+func (c *Connector) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errCh := make(chan error, 2)
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		c.bridge.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		errCh <- c.relay.Run(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		errCh <- c.agent.Run(ctx)
+	}()
+
+	var runErr error
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil {
+			runErr = err
+			break
+		}
+	}
+	cancel()
+	wg.Wait()
+	return runErr
+}
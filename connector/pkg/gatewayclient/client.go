@@ -6,8 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -18,6 +20,14 @@ import (
 
 var ErrGatewayAuthFailed = errors.New("gateway auth failed")
 
+// dialer is websocket.DefaultDialer with permessage-deflate enabled; it is
+// only used if the gateway agrees to it.
+var dialer = &websocket.Dialer{
+	Proxy:             http.ProxyFromEnvironment,
+	HandshakeTimeout:  45 * time.Second,
+	EnableCompression: true,
+}
+
 type Handlers struct {
 	OnEvent        func(sessionID string, event protocol.Event)
 	OnDisconnected func(err error)
@@ -33,13 +43,21 @@ type Client struct {
 	conn    *websocket.Conn
 	writeMu sync.Mutex
 
-	stateMu       sync.RWMutex
-	ready         bool
-	lastSessionID string
+	stateMu   sync.RWMutex
+	ready     bool
+	lastRoute route
 
 	mapMu        sync.RWMutex
-	reqToSession map[string]string
-	runToSession map[string]string
+	reqToSession map[string]track
+	runToSession map[string]track
+	// cancels holds stops, keyed by session and event id, that arrived
+	// before the gateway reported the run id to abort.
+	cancels map[route]struct{}
+
+	watchMu sync.Mutex
+	watches map[string]*runWatch
+
+	droppedEvents atomic.Int64
 }
 
 type envelope struct {
@@ -56,17 +74,36 @@ type gatewayError struct {
 	Message string `json:"message,omitempty"`
 }
 
+// Defaults for timeouts left unset in cfg, matching config.Load.
+const (
+	defaultFirstTokenTimeoutSeconds = 60
+	defaultRunTimeoutSeconds        = 600
+)
+
 func New(cfg config.GatewayConfig, logger *log.Logger, handlers Handlers) *Client {
+	if cfg.FirstTokenTimeoutSeconds <= 0 {
+		cfg.FirstTokenTimeoutSeconds = defaultFirstTokenTimeoutSeconds
+	}
+	if cfg.RunTimeoutSeconds <= 0 {
+		cfg.RunTimeoutSeconds = defaultRunTimeoutSeconds
+	}
+	if cfg.RunTTLSeconds <= 0 {
+		cfg.RunTTLSeconds = cfg.RunTimeoutSeconds + 60
+	}
 	return &Client{
 		cfg:          cfg,
 		logger:       logger,
 		handlers:     handlers,
-		reqToSession: map[string]string{},
-		runToSession: map[string]string{},
+		reqToSession: map[string]track{},
+		runToSession: map[string]track{},
+		cancels:      map[route]struct{}{},
+		watches:      map[string]*runWatch{},
 	}
 }
 
 func (c *Client) Run(ctx context.Context) error {
+	go c.sweepLoop(ctx)
+
 	backoff := time.Duration(c.cfg.ReconnectInitialSeconds) * time.Second
 	maxBackoff := time.Duration(c.cfg.ReconnectMaxSeconds) * time.Second
 
@@ -107,7 +144,7 @@ func (c *Client) Run(ctx context.Context) error {
 }
 
 func (c *Client) connectAndServe(ctx context.Context) error {
-	conn, _, err := websocket.DefaultDialer.Dial(c.cfg.URL, nil)
+	conn, _, err := dialer.Dial(c.cfg.URL, nil)
 	if err != nil {
 		return err
 	}
@@ -125,6 +162,7 @@ func (c *Client) connectAndServe(ctx context.Context) error {
 		close(connDone)
 		c.setReady(false)
 		c.closeConn()
+		c.resetRuns()
 	}()
 
 	if err := c.waitForChallenge(conn); err != nil {
@@ -300,8 +338,12 @@ func (c *Client) SendUserMessage(sessionID string, event protocol.Event) error {
 	if images := normalizeImages(event.Images); len(images) > 0 {
 		params["images"] = images
 	}
+	if files := normalizeFiles(event.Files); len(files) > 0 {
+		params["attachments"] = files
+	}
 
-	c.trackRequest(reqID, sessionID)
+	rt := route{sessionID: sessionID, eventID: event.ID, reqID: reqID}
+	c.trackRequest(reqID, rt)
 	msg := map[string]any{
 		"type":   "req",
 		"id":     reqID,
@@ -313,20 +355,54 @@ func (c *Client) SendUserMessage(sessionID string, event protocol.Event) error {
 		c.untrackRequest(reqID)
 		return err
 	}
+	c.watchRun(rt)
 	return nil
 }
 
-func (c *Client) SendCancel(sessionID string) error {
+// DroppedEvents reports how many gateway events were dropped because they
+// could not be correlated with a bridge session.
+func (c *Client) DroppedEvents() int64 {
+	return c.droppedEvents.Load()
+}
+
+// SendCancel aborts the active run of a session. When eventID is set only the
+// run started by the user_message with that id is aborted; if the gateway has
+// not reported its run id yet, the abort is sent once it does.
+func (c *Client) SendCancel(sessionID, eventID string) error {
+	target := route{sessionID: sessionID, eventID: eventID}
+	if eventID == "" {
+		return c.sendAbort(target, "")
+	}
+	runID, tracked := c.findRun(target)
+	if !tracked {
+		return fmt.Errorf("no active request with id %q", eventID)
+	}
+	if runID == "" {
+		c.deferCancel(target)
+		return nil
+	}
+	return c.sendAbort(target, runID)
+}
+
+// sendAbort sends chat.abort for the session of target, limited to runID
+// when it is set.
+func (c *Client) sendAbort(target route, runID string) error {
+	params := map[string]any{
+		"sessionKey": gatewaySessionKey(target.sessionID),
+	}
+	if runID != "" {
+		params["runId"] = runID
+	}
+
 	reqID := newID("gw_cancel_")
-	c.trackRequest(reqID, sessionID)
+	target.reqID = reqID
+	c.trackRequest(reqID, target)
 
 	msg := map[string]any{
 		"type":   "req",
 		"id":     reqID,
 		"method": "chat.abort",
-		"params": map[string]any{
-			"sessionKey": gatewaySessionKey(sessionID),
-		},
+		"params": params,
 	}
 
 	if err := c.writeJSON(msg); err != nil {
@@ -336,6 +412,18 @@ func (c *Client) SendCancel(sessionID string) error {
 	return nil
 }
 
+// startRun tracks runID for rt and sends a stop that was requested before
+// the run id was known.
+func (c *Client) startRun(runID string, rt route) {
+	c.trackRun(runID, rt)
+	if !c.takeCancel(rt) {
+		return
+	}
+	if err := c.sendAbort(rt, runID); err != nil {
+		c.logger.Printf("gateway deferred abort failed sid=%s id=%s run_id=%s err=%v", rt.sessionID, rt.eventID, runID, err)
+	}
+}
+
 func (c *Client) IsReady() bool {
 	c.stateMu.RLock()
 	defer c.stateMu.RUnlock()
@@ -347,14 +435,14 @@ func (c *Client) handleResponse(env envelope) error {
 		return nil
 	}
 
-	sessionID, ok := c.requestSession(env.ID)
+	rt, ok := c.requestRoute(env.ID)
 	if !ok {
 		return nil
 	}
 
 	payload := decodePayload(env.Payload)
 	if runID := extractRunID(payload); runID != "" {
-		c.trackRun(runID, sessionID)
+		c.startRun(runID, rt)
 	}
 
 	if env.OK != nil && *env.OK {
@@ -362,34 +450,37 @@ func (c *Client) handleResponse(env envelope) error {
 		switch {
 		case isPendingStatus(status):
 			if content := extractContent(payload); content != "" {
-				c.emitEvent(sessionID, protocol.Event{Type: protocol.EventToken, Content: content})
+				c.emitEvent(rt, protocol.Event{Type: protocol.EventToken, Content: content})
 			}
 		case isFinalStatus(status):
 			if content := extractContent(payload); content != "" {
-				c.emitEvent(sessionID, protocol.Event{Type: protocol.EventToken, Content: content})
+				c.emitEvent(rt, protocol.Event{Type: protocol.EventToken, Content: content})
+			}
+			for _, media := range extractMediaEvents(payload) {
+				c.emitEvent(rt, media)
 			}
-			c.emitEvent(sessionID, protocol.Event{Type: protocol.EventEnd})
-			c.clearSessionTracks(sessionID)
+			c.emitEvent(rt, protocol.Event{Type: protocol.EventEnd, Meta: extractRunMeta(payload)})
+			c.clearTracks(rt)
 		case isErrorStatus(status):
-			c.emitEvent(sessionID, protocol.Event{
+			c.emitEvent(rt, protocol.Event{
 				Type:    protocol.EventError,
 				Code:    "GATEWAY_REQUEST_FAILED",
 				Message: extractErrorMessageFromPayload(payload),
 			})
-			c.clearSessionTracks(sessionID)
+			c.clearTracks(rt)
 		default:
 			if content := extractContent(payload); content != "" {
-				c.emitEvent(sessionID, protocol.Event{Type: protocol.EventToken, Content: content})
-				c.emitEvent(sessionID, protocol.Event{Type: protocol.EventEnd})
-				c.clearSessionTracks(sessionID)
+				c.emitEvent(rt, protocol.Event{Type: protocol.EventToken, Content: content})
+				c.emitEvent(rt, protocol.Event{Type: protocol.EventEnd, Meta: extractRunMeta(payload)})
+				c.clearTracks(rt)
 			}
 		}
 		return nil
 	}
 
 	errMsg := extractErrorMessage(env)
-	c.emitEvent(sessionID, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_REQUEST_FAILED", Message: errMsg})
-	c.clearSessionTracks(sessionID)
+	c.emitEvent(rt, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_REQUEST_FAILED", Message: errMsg})
+	c.clearTracks(rt)
 	return nil
 }
 
@@ -397,42 +488,35 @@ func (c *Client) handleEvent(env envelope) {
 	payload := decodePayload(env.Payload)
 	corrID := extractCorrelationID(env, payload)
 	runID := extractRunID(payload)
-	sessionID := c.resolveSessionID(corrID, runID, payload)
-	if sessionID == "" {
+
+	events := mapGatewayEvent(env)
+	if len(events) == 0 {
 		return
 	}
 
-	events := mapGatewayEvent(sessionID, env)
-	for _, event := range events {
-		c.emitEvent(sessionID, event)
-		if event.Type == protocol.EventEnd || event.Type == protocol.EventError {
-			c.clearSessionTracks(sessionID)
+	rt, matched := c.resolveRoute(corrID, runID, payload)
+	if !matched {
+		if c.cfg.LogUnmatchedEvents {
+			c.logger.Printf("unmatched gateway event event=%s corr_id=%s run_id=%s fallback_sid=%s", env.Event, corrID, runID, rt.sessionID)
 		}
-	}
-}
-
-func (c *Client) resolveSessionID(corrID, runID string, payload map[string]any) string {
-	if sid := extractSessionID(payload); sid != "" {
-		return sid
-	}
-	if corrID != "" {
-		if sid, ok := c.requestSession(corrID); ok {
-			return sid
+		if c.cfg.Strict() || rt.sessionID == "" {
+			dropped := c.droppedEvents.Add(1)
+			c.logger.Printf("drop uncorrelated gateway event event=%s dropped_total=%d", env.Event, dropped)
+			return
 		}
+	} else if runID != "" {
+		c.startRun(runID, rt)
 	}
-	if runID != "" {
-		if sid, ok := c.runSession(runID); ok {
-			return sid
+
+	for _, event := range events {
+		if event.Type == protocol.EventEnd {
+			event.Meta = extractRunMeta(payload)
 		}
-	}
-	if corrID != "" {
-		if sid, ok := c.runSession(corrID); ok {
-			return sid
+		c.emitEvent(rt, event)
+		if event.Type == protocol.EventEnd || event.Type == protocol.EventError {
+			c.clearTracks(rt)
 		}
 	}
-	c.stateMu.RLock()
-	defer c.stateMu.RUnlock()
-	return c.lastSessionID
 }
 
 func (c *Client) writeJSON(v any) error {
@@ -454,62 +538,24 @@ func (c *Client) writeJSON(v any) error {
 	return conn.WriteMessage(websocket.TextMessage, data)
 }
 
-func (c *Client) trackRequest(reqID, sessionID string) {
-	c.mapMu.Lock()
-	defer c.mapMu.Unlock()
-	c.reqToSession[reqID] = sessionID
-
-	c.stateMu.Lock()
-	c.lastSessionID = sessionID
-	c.stateMu.Unlock()
-}
-
-func (c *Client) untrackRequest(reqID string) {
-	c.mapMu.Lock()
-	defer c.mapMu.Unlock()
-	delete(c.reqToSession, reqID)
-}
-
-func (c *Client) requestSession(reqID string) (string, bool) {
-	c.mapMu.RLock()
-	defer c.mapMu.RUnlock()
-	sid, ok := c.reqToSession[reqID]
-	return sid, ok
-}
-
-func (c *Client) trackRun(runID, sessionID string) {
-	c.mapMu.Lock()
-	defer c.mapMu.Unlock()
-	c.runToSession[runID] = sessionID
-}
-
-func (c *Client) runSession(runID string) (string, bool) {
-	c.mapMu.RLock()
-	defer c.mapMu.RUnlock()
-	sid, ok := c.runToSession[runID]
-	return sid, ok
-}
-
-func (c *Client) clearSessionTracks(sessionID string) {
-	c.mapMu.Lock()
-	defer c.mapMu.Unlock()
-	for reqID, sid := range c.reqToSession {
-		if sid == sessionID {
-			delete(c.reqToSession, reqID)
+func (c *Client) emitEvent(rt route, event protocol.Event) {
+	if event.Type == protocol.EventEnd {
+		if event.Meta == nil {
+			event.Meta = &protocol.RunMeta{}
 		}
-	}
-	for runID, sid := range c.runToSession {
-		if sid == sessionID {
-			delete(c.runToSession, runID)
+		if event.Meta.RunID == "" {
+			event.Meta.RunID, _ = c.findRun(rt)
 		}
 	}
-}
-
-func (c *Client) emitEvent(sessionID string, event protocol.Event) {
+	c.observeRun(rt, &event)
+	if event.Meta != nil && *event.Meta == (protocol.RunMeta{}) {
+		event.Meta = nil
+	}
 	if c.handlers.OnEvent == nil {
 		return
 	}
-	c.handlers.OnEvent(sessionID, event)
+	event.ID = rt.eventID
+	c.handlers.OnEvent(rt.sessionID, event)
 }
 
 func (c *Client) setConn(conn *websocket.Conn) {
@@ -555,13 +601,34 @@ func normalizeImages(images []protocol.ImageItem) []map[string]any {
 	return out
 }
 
+func normalizeFiles(files []protocol.FileItem) []map[string]any {
+	out := make([]map[string]any, 0, len(files))
+	for _, item := range files {
+		data := strings.TrimSpace(item.Data)
+		if data == "" {
+			continue
+		}
+		m := map[string]any{"type": "file", "content": data}
+		if mimeType := strings.TrimSpace(item.MimeType); mimeType != "" {
+			m["mimeType"] = mimeType
+		}
+		if name := strings.TrimSpace(item.Name); name != "" {
+			m["fileName"] = name
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
 func isUnauthorized(msg string) bool {
 	lower := strings.ToLower(msg)
 	return strings.Contains(lower, "unauthorized") || strings.Contains(lower, "forbidden")
 }
 
+const gatewaySessionKeyPrefix = "bridge_"
+
 func gatewaySessionKey(sessionID string) string {
-	return "bridge_" + sessionID
+	return gatewaySessionKeyPrefix + sessionID
 }
 
 func stringValue(v any) string {
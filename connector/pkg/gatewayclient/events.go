@@ -87,6 +87,21 @@ func extractSessionID(payload map[string]any) string {
 	return ""
 }
 
+// extractBridgeSessionID recovers the bridge session id from the gateway
+// sessionKey the connector assigned in gatewaySessionKey. The gateway may
+// qualify the key (e.g. "agent:main:bridge_s_x"), so only the last segment
+// is considered.
+func extractBridgeSessionID(payload map[string]any) string {
+	key := stringValue(payload["sessionKey"])
+	if i := strings.LastIndex(key, ":"); i >= 0 {
+		key = key[i+1:]
+	}
+	if !strings.HasPrefix(key, gatewaySessionKeyPrefix) {
+		return ""
+	}
+	return strings.TrimPrefix(key, gatewaySessionKeyPrefix)
+}
+
 func extractContent(payload map[string]any) string {
 	for _, key := range []string{"content", "text", "token", "chunk", "delta"} {
 		if content := stringValue(payload[key]); content != "" {
@@ -156,7 +171,7 @@ func messageContentText(v any) string {
 	}
 }
 
-func mapGatewayEvent(sessionID string, env envelope) []protocol.Event {
+func mapGatewayEvent(env envelope) []protocol.Event {
 	payload := decodePayload(env.Payload)
 	eventName := strings.ToLower(strings.TrimSpace(env.Event))
 	status := strings.ToLower(strings.TrimSpace(stringValue(payload["status"])))
@@ -173,6 +188,7 @@ func mapGatewayEvent(sessionID string, env envelope) []protocol.Event {
 			if content := extractContent(payload); content != "" {
 				events = append(events, protocol.Event{Type: protocol.EventToken, Content: content})
 			}
+			events = append(events, extractMediaEvents(payload)...)
 			events = append(events, protocol.Event{Type: protocol.EventEnd})
 			return events
 		case isErrorStatus(status):
@@ -198,6 +214,7 @@ func mapGatewayEvent(sessionID string, env envelope) []protocol.Event {
 			if text != "" {
 				events = append(events, protocol.Event{Type: protocol.EventToken, Content: text})
 			}
+			events = append(events, extractMediaEvents(payload)...)
 			events = append(events, protocol.Event{Type: protocol.EventEnd})
 			return events
 		case "error":
@@ -213,6 +230,10 @@ func mapGatewayEvent(sessionID string, env envelope) []protocol.Event {
 	}
 
 	if isAgentEventName(eventName) {
+		if events, handled := mapAgentStream(payload); handled {
+			return events
+		}
+
 		events := []protocol.Event{}
 		if text := extractAgentText(payload); text != "" {
 			events = append(events, protocol.Event{Type: protocol.EventToken, Content: text})
@@ -224,6 +245,7 @@ func mapGatewayEvent(sessionID string, env envelope) []protocol.Event {
 		}
 		switch terminal {
 		case "final", "done", "completed", "end", "ended", "finish", "finished":
+			events = append(events, extractMediaEvents(payload)...)
 			events = append(events, protocol.Event{Type: protocol.EventEnd})
 		case "error", "failed":
 			events = append(events, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_EVENT_ERROR", Message: extractErrorMessageFromPayload(payload)})
@@ -247,10 +269,84 @@ func mapGatewayEvent(sessionID string, env envelope) []protocol.Event {
 		return []protocol.Event{{Type: protocol.EventError, Code: "GATEWAY_DISCONNECTED", Message: "gateway disconnected"}}
 	}
 
-	_ = sessionID
 	return nil
 }
 
+// mapAgentStream maps the non-assistant streams of OpenClaw agent events
+// (tool invocations, reasoning, lifecycle). handled is false for streams that
+// carry assistant text and go through the generic agent mapping.
+func mapAgentStream(payload map[string]any) (events []protocol.Event, handled bool) {
+	stream := strings.ToLower(strings.TrimSpace(stringValue(payload["stream"])))
+	data, _ := payload["data"].(map[string]any)
+	if data == nil {
+		data = map[string]any{}
+	}
+	phase := strings.ToLower(strings.TrimSpace(stringValue(data["phase"])))
+
+	switch stream {
+	case "tool":
+		tool := &protocol.ToolInfo{
+			CallID: firstString(data, "toolCallId", "tool_call_id", "callId", "id"),
+			Name:   firstString(data, "name", "tool", "toolName"),
+		}
+		switch phase {
+		case "start", "call":
+			tool.Args = rawJSON(firstValue(data, "args", "arguments", "input"))
+			return []protocol.Event{{Type: protocol.EventToolCall, Tool: tool}}, true
+		case "result", "end", "done":
+			tool.Result = rawJSON(firstValue(data, "result", "output", "content"))
+			tool.IsError, _ = data["isError"].(bool)
+			return []protocol.Event{{Type: protocol.EventToolResult, Tool: tool}}, true
+		}
+		return nil, true
+	case "thinking", "reasoning":
+		text := firstString(data, "delta", "text", "content")
+		if text == "" {
+			return nil, true
+		}
+		return []protocol.Event{{Type: protocol.EventReasoning, Content: text}}, true
+	case "lifecycle":
+		if phase == "" {
+			return nil, true
+		}
+		event := protocol.Event{Type: protocol.EventStatus, Status: "run_" + phase}
+		if phase == "error" {
+			event.Message = extractErrorMessageFromPayload(data)
+		}
+		return []protocol.Event{event}, true
+	}
+	return nil, false
+}
+
+func firstValue(m map[string]any, keys ...string) any {
+	for _, key := range keys {
+		if v, ok := m[key]; ok && v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+func firstString(m map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if v := stringValue(m[key]); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func rawJSON(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
 func isPendingStatus(status string) bool {
 	switch status {
 	case "accepted", "queued", "started", "running", "in_flight", "inflight", "pending":
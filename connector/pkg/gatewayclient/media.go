@@ -0,0 +1,117 @@
+package gatewayclient
+
+import (
+	"encoding/base64"
+	"strings"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// extractMediaEvents turns the non-text content parts of a final chat or
+// agent payload into media events. It walks the same containers as
+// extractChatText.
+func extractMediaEvents(payload map[string]any) []protocol.Event {
+	for _, key := range []string{"response", "result", "data", "output"} {
+		if nested, ok := payload[key].(map[string]any); ok {
+			if events := extractMediaEvents(nested); len(events) > 0 {
+				return events
+			}
+		}
+	}
+
+	var parts []any
+	if msgObj, ok := payload["message"].(map[string]any); ok {
+		parts, _ = msgObj["content"].([]any)
+	}
+	if parts == nil {
+		parts, _ = payload["content"].([]any)
+	}
+
+	var events []protocol.Event
+	for _, item := range parts {
+		part, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		if media, ok := mediaFromPart(part); ok {
+			events = append(events, protocol.Event{Type: protocol.EventMedia, Media: media})
+		}
+	}
+	return events
+}
+
+// mediaFromPart understands the common content part shapes:
+// {type:image,data,mimeType}, {type:image,source:{type:base64|url,...}},
+// {type:image_url,image_url:{url}} and {type:file|document|audio,...}.
+func mediaFromPart(part map[string]any) (*protocol.MediaInfo, bool) {
+	kind := strings.ToLower(strings.TrimSpace(stringValue(part["type"])))
+	switch kind {
+	case "", "text", "thinking", "reasoning", "tool_use", "tool_call", "toolcall", "tool_result":
+		return nil, false
+	}
+
+	media := &protocol.MediaInfo{
+		MimeType: firstString(part, "mimeType", "mime_type", "media_type"),
+		Name:     firstString(part, "fileName", "filename", "name"),
+	}
+	data := firstString(part, "data", "content")
+	url := firstString(part, "url")
+
+	if source, ok := part["source"].(map[string]any); ok {
+		if media.MimeType == "" {
+			media.MimeType = firstString(source, "media_type", "mimeType")
+		}
+		if data == "" {
+			data = firstString(source, "data")
+		}
+		if url == "" {
+			url = firstString(source, "url")
+		}
+	}
+	if imageURL, ok := part["image_url"].(map[string]any); ok && url == "" {
+		url = firstString(imageURL, "url")
+	}
+
+	if mimeType, encoded, ok := parseDataURL(url); ok {
+		url = ""
+		data = encoded
+		if media.MimeType == "" {
+			media.MimeType = mimeType
+		}
+	}
+
+	switch {
+	case data != "":
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, false
+		}
+		media.Data = data
+		media.Size = int64(len(raw))
+	case url != "":
+		media.URL = url
+	default:
+		return nil, false
+	}
+	if media.MimeType == "" && kind == "image" {
+		media.MimeType = "image/png"
+	}
+	return media, true
+}
+
+// parseDataURL splits a base64 data URL into its MIME type and payload.
+func parseDataURL(url string) (mimeType, data string, ok bool) {
+	rest, found := strings.CutPrefix(url, "data:")
+	if !found {
+		return "", "", false
+	}
+	header, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	header, isBase64 := strings.CutSuffix(header, ";base64")
+	if !isBase64 {
+		return "", "", false
+	}
+	return header, data, true
+}
@@ -0,0 +1,82 @@
+package gatewayclient
+
+import (
+	"encoding/json"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// metaContainers are the keys under which OpenClaw nests run metadata in
+// chat and agent payloads (e.g. message.usage, result.meta.agentMeta.model).
+var metaContainers = []string{"message", "result", "response", "data", "output", "meta", "agentMeta", "run"}
+
+// extractRunMeta collects model, stop reason, usage and timing from a final
+// chat or agent payload. It returns nil when the payload carries none.
+func extractRunMeta(payload map[string]any) *protocol.RunMeta {
+	meta := &protocol.RunMeta{}
+	collectRunMeta(payload, meta, 0)
+	if *meta == (protocol.RunMeta{}) {
+		return nil
+	}
+	return meta
+}
+
+func collectRunMeta(m map[string]any, meta *protocol.RunMeta, depth int) {
+	if depth > 4 {
+		return
+	}
+	if meta.RunID == "" {
+		meta.RunID = firstString(m, "runId", "run_id")
+	}
+	if meta.Model == "" {
+		meta.Model = firstString(m, "model", "modelId")
+	}
+	if meta.Provider == "" {
+		meta.Provider = firstString(m, "provider")
+	}
+	if meta.StopReason == "" {
+		meta.StopReason = firstString(m, "stopReason", "stop_reason", "finishReason", "finish_reason")
+	}
+	if meta.DurationMs == 0 {
+		meta.DurationMs = int64Value(firstValue(m, "durationMs", "duration_ms"))
+	}
+	if meta.Usage == nil {
+		if usage, ok := m["usage"].(map[string]any); ok {
+			meta.Usage = parseUsage(usage)
+		}
+	}
+	for _, key := range metaContainers {
+		if nested, ok := m[key].(map[string]any); ok {
+			collectRunMeta(nested, meta, depth+1)
+		}
+	}
+}
+
+func parseUsage(m map[string]any) *protocol.Usage {
+	usage := &protocol.Usage{
+		InputTokens:      int64Value(firstValue(m, "input", "inputTokens", "input_tokens", "prompt_tokens")),
+		OutputTokens:     int64Value(firstValue(m, "output", "outputTokens", "output_tokens", "completion_tokens")),
+		CacheReadTokens:  int64Value(firstValue(m, "cacheRead", "cacheReadTokens", "cache_read_input_tokens")),
+		CacheWriteTokens: int64Value(firstValue(m, "cacheWrite", "cacheWriteTokens", "cache_creation_input_tokens")),
+		TotalTokens:      int64Value(firstValue(m, "total", "totalTokens", "total_tokens")),
+	}
+	if *usage == (protocol.Usage{}) {
+		return nil
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.InputTokens + usage.OutputTokens + usage.CacheReadTokens + usage.CacheWriteTokens
+	}
+	return usage
+}
+
+func int64Value(v any) int64 {
+	switch t := v.(type) {
+	case float64:
+		return int64(t)
+	case json.Number:
+		n, _ := t.Int64()
+		return n
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,207 @@
+package gatewayclient
+
+import (
+	"context"
+	"time"
+)
+
+// route ties a gateway request or run to the bridge session and the optional
+// client-supplied event id that started it. reqID is the gateway request of
+// the user_message, which tells apart messages sent without an event id.
+type route struct {
+	sessionID string
+	eventID   string
+	reqID     string
+}
+
+// covers reports whether t belongs to the run rt refers to. A route without
+// reqID covers every request for its session and event id.
+func (rt route) covers(t route) bool {
+	return rt.sessionID == t.sessionID && rt.eventID == t.eventID && (rt.reqID == "" || rt.reqID == t.reqID)
+}
+
+type track struct {
+	route
+	seenAt time.Time
+}
+
+// resolveRoute finds the bridge route for a gateway event. matched is false
+// when the event could not be correlated with a tracked request, run or
+// bridge sessionKey; the returned route is then only a best-effort fallback.
+func (c *Client) resolveRoute(corrID, runID string, payload map[string]any) (rt route, matched bool) {
+	if corrID != "" {
+		if rt, ok := c.requestRoute(corrID); ok {
+			return rt, true
+		}
+	}
+	if runID != "" {
+		if rt, ok := c.runRoute(runID); ok {
+			return rt, true
+		}
+	}
+	if corrID != "" {
+		if rt, ok := c.runRoute(corrID); ok {
+			return rt, true
+		}
+	}
+	if sid := extractBridgeSessionID(payload); sid != "" {
+		return c.sessionRoute(sid), true
+	}
+	if sid := extractSessionID(payload); sid != "" {
+		return route{sessionID: sid}, false
+	}
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.lastRoute, false
+}
+
+func (c *Client) trackRequest(reqID string, rt route) {
+	c.mapMu.Lock()
+	defer c.mapMu.Unlock()
+	c.reqToSession[reqID] = track{route: rt, seenAt: time.Now()}
+
+	c.stateMu.Lock()
+	c.lastRoute = rt
+	c.stateMu.Unlock()
+}
+
+func (c *Client) untrackRequest(reqID string) {
+	c.mapMu.Lock()
+	defer c.mapMu.Unlock()
+	delete(c.reqToSession, reqID)
+}
+
+// requestRoute looks up a request and refreshes it, so requests that are
+// still answered are not swept.
+func (c *Client) requestRoute(reqID string) (route, bool) {
+	c.mapMu.Lock()
+	defer c.mapMu.Unlock()
+	t, ok := c.reqToSession[reqID]
+	if ok {
+		t.seenAt = time.Now()
+		c.reqToSession[reqID] = t
+	}
+	return t.route, ok
+}
+
+// sessionRoute returns the most recently seen route tracked for a bridge
+// session, so events correlated only by sessionKey keep the client's event
+// id. It falls back to the bare session when nothing is tracked.
+func (c *Client) sessionRoute(sessionID string) route {
+	c.mapMu.RLock()
+	defer c.mapMu.RUnlock()
+	best := track{route: route{sessionID: sessionID}}
+	for _, tracks := range []map[string]track{c.runToSession, c.reqToSession} {
+		for _, t := range tracks {
+			if t.sessionID == sessionID && t.seenAt.After(best.seenAt) {
+				best = t
+			}
+		}
+	}
+	return best.route
+}
+
+// trackRun records or refreshes a run, so active runs are not swept while
+// they keep producing events.
+func (c *Client) trackRun(runID string, rt route) {
+	c.mapMu.Lock()
+	defer c.mapMu.Unlock()
+	c.runToSession[runID] = track{route: rt, seenAt: time.Now()}
+}
+
+func (c *Client) runRoute(runID string) (route, bool) {
+	c.mapMu.RLock()
+	defer c.mapMu.RUnlock()
+	t, ok := c.runToSession[runID]
+	return t.route, ok
+}
+
+// deferCancel records a stop for the run of rt until its run id is known.
+func (c *Client) deferCancel(rt route) {
+	c.mapMu.Lock()
+	defer c.mapMu.Unlock()
+	c.cancels[route{sessionID: rt.sessionID, eventID: rt.eventID}] = struct{}{}
+}
+
+// takeCancel reports and forgets a stop deferred for the run of rt.
+func (c *Client) takeCancel(rt route) bool {
+	key := route{sessionID: rt.sessionID, eventID: rt.eventID}
+	c.mapMu.Lock()
+	defer c.mapMu.Unlock()
+	_, ok := c.cancels[key]
+	delete(c.cancels, key)
+	return ok
+}
+
+// findRun returns the gateway run id started for rt. tracked reports whether
+// any request or run covered by rt is still registered, even if the run id
+// is not known yet.
+func (c *Client) findRun(rt route) (runID string, tracked bool) {
+	c.mapMu.RLock()
+	defer c.mapMu.RUnlock()
+	for id, t := range c.runToSession {
+		if rt.covers(t.route) {
+			return id, true
+		}
+	}
+	for _, t := range c.reqToSession {
+		if rt.covers(t.route) {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+func (c *Client) clearTracks(rt route) {
+	c.mapMu.Lock()
+	defer c.mapMu.Unlock()
+	for reqID, t := range c.reqToSession {
+		if t.route == rt {
+			delete(c.reqToSession, reqID)
+		}
+	}
+	for runID, t := range c.runToSession {
+		if t.route == rt {
+			delete(c.runToSession, runID)
+		}
+	}
+	delete(c.cancels, route{sessionID: rt.sessionID, eventID: rt.eventID})
+}
+
+func (c *Client) sweepLoop(ctx context.Context) {
+	ttl := time.Duration(c.cfg.RunTTLSeconds) * time.Second
+	ticker := time.NewTicker(ttl / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			c.sweepTracks(now.Add(-ttl))
+		}
+	}
+}
+
+// sweepTracks drops requests and runs that have not been seen since cutoff,
+// which covers runs whose terminal event never arrived.
+func (c *Client) sweepTracks(cutoff time.Time) {
+	c.mapMu.Lock()
+	defer c.mapMu.Unlock()
+	removed := 0
+	for reqID, t := range c.reqToSession {
+		if t.seenAt.Before(cutoff) {
+			delete(c.reqToSession, reqID)
+			removed++
+		}
+	}
+	for runID, t := range c.runToSession {
+		if t.seenAt.Before(cutoff) {
+			delete(c.runToSession, runID)
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.logger.Printf("gateway swept stale tracks removed=%d", removed)
+	}
+}
@@ -0,0 +1,135 @@
+package gatewayclient
+
+import (
+	"fmt"
+	"time"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// runWatch holds the timers guarding one in-flight user_message. Watches are
+// keyed by the gateway request id of the message.
+type runWatch struct {
+	rt         route
+	firstToken *time.Timer
+	total      *time.Timer
+
+	startedAt    time.Time
+	firstTokenAt time.Time
+}
+
+func (w *runWatch) stop() {
+	if w.firstToken != nil {
+		w.firstToken.Stop()
+	}
+	if w.total != nil {
+		w.total.Stop()
+	}
+}
+
+// watchRun arms the first-token and total-run timers for the request rt
+// was sent with.
+func (c *Client) watchRun(rt route) {
+	firstToken := time.Duration(c.cfg.FirstTokenTimeoutSeconds) * time.Second
+	total := time.Duration(c.cfg.RunTimeoutSeconds) * time.Second
+
+	w := &runWatch{rt: rt, startedAt: time.Now()}
+	c.watchMu.Lock()
+	c.watches[rt.reqID] = w
+	w.firstToken = time.AfterFunc(firstToken, func() {
+		c.expireRun(rt, w, fmt.Sprintf("no response from gateway within %s", firstToken))
+	})
+	w.total = time.AfterFunc(total, func() {
+		c.expireRun(rt, w, fmt.Sprintf("gateway run exceeded %s", total))
+	})
+	c.watchMu.Unlock()
+}
+
+// observeRun updates the watch for rt before an event is emitted. Only
+// token output disarms the first-token timer: status, reasoning and tool
+// events do not show that the run is answering. End events get the
+// connector-side timing filled into their meta.
+func (c *Client) observeRun(rt route, event *protocol.Event) {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+	w, ok := c.watches[rt.reqID]
+	if !ok || rt.reqID == "" {
+		return
+	}
+	now := time.Now()
+	switch event.Type {
+	case protocol.EventEnd, protocol.EventError:
+		w.stop()
+		delete(c.watches, rt.reqID)
+		if event.Meta != nil {
+			if event.Meta.DurationMs == 0 {
+				event.Meta.DurationMs = now.Sub(w.startedAt).Milliseconds()
+			}
+			if !w.firstTokenAt.IsZero() {
+				event.Meta.FirstTokenMs = w.firstTokenAt.Sub(w.startedAt).Milliseconds()
+			}
+		}
+	case protocol.EventToken:
+		if w.firstTokenAt.IsZero() {
+			w.firstTokenAt = now
+			w.firstToken.Stop()
+		}
+	}
+}
+
+// expireRun aborts a run that hit one of its timeouts and reports
+// GATEWAY_TIMEOUT to the session. It is a no-op if w is no longer current.
+func (c *Client) expireRun(rt route, w *runWatch, reason string) {
+	c.watchMu.Lock()
+	if c.watches[rt.reqID] != w {
+		c.watchMu.Unlock()
+		return
+	}
+	w.stop()
+	delete(c.watches, rt.reqID)
+	c.watchMu.Unlock()
+
+	runID, _ := c.findRun(rt)
+	params := map[string]any{
+		"sessionKey": gatewaySessionKey(rt.sessionID),
+	}
+	if runID != "" {
+		params["runId"] = runID
+	}
+	if err := c.writeJSON(map[string]any{
+		"type":   "req",
+		"id":     newID("gw_abort_"),
+		"method": "chat.abort",
+		"params": params,
+	}); err != nil {
+		c.logger.Printf("gateway abort after timeout failed sid=%s err=%v", rt.sessionID, err)
+	}
+
+	c.logger.Printf("gateway run timeout sid=%s id=%s run_id=%s reason=%s", rt.sessionID, rt.eventID, runID, reason)
+	c.clearTracks(rt)
+	c.emitEvent(rt, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_TIMEOUT", Message: reason})
+}
+
+// resetRuns forgets every tracked request, run and watch, and fails the runs
+// that were still in flight. Runs do not survive a gateway reconnect, so
+// their state is garbage once the connection drops.
+func (c *Client) resetRuns() {
+	c.watchMu.Lock()
+	lost := make([]route, 0, len(c.watches))
+	for reqID, w := range c.watches {
+		w.stop()
+		delete(c.watches, reqID)
+		lost = append(lost, w.rt)
+	}
+	c.watchMu.Unlock()
+
+	c.mapMu.Lock()
+	clear(c.reqToSession)
+	clear(c.runToSession)
+	clear(c.cancels)
+	c.mapMu.Unlock()
+
+	for _, rt := range lost {
+		c.emitEvent(rt, protocol.Event{Type: protocol.EventError, Code: "GATEWAY_DISCONNECTED", Message: "gateway disconnected during run"})
+	}
+}
@@ -0,0 +1,237 @@
+package images
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+// maxPixels bounds the decoded size of any image, including ones that would
+// be downscaled, so a small file cannot expand into gigabytes of pixels.
+const maxPixels = 100_000_000
+
+// DefaultAllowedTypes are accepted when Limits.AllowedTypes is empty.
+var DefaultAllowedTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+type Limits struct {
+	MaxBytes     int64
+	MaxWidth     int
+	MaxHeight    int
+	MaxCount     int
+	AllowedTypes []string
+	// Downscale shrinks images that exceed MaxWidth/MaxHeight or MaxBytes
+	// instead of rejecting them. WebP can be validated but not re-encoded.
+	Downscale bool
+	// Reencode forces the output format of processed images: "png", "jpeg",
+	// or empty to keep the source format (GIF becomes PNG). Transparent
+	// images re-encoded as JPEG are composited onto white.
+	Reencode    string
+	JPEGQuality int
+}
+
+// Error carries the event error code reported to the client.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func errorf(code, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Normalize validates every image against limits and returns them with
+// their sniffed MIME type, downscaled or re-encoded where allowed.
+func Normalize(items []protocol.ImageItem, limits Limits) ([]protocol.ImageItem, error) {
+	if limits.MaxCount > 0 && len(items) > limits.MaxCount {
+		return nil, errorf("IMAGE_TOO_MANY", "%d images sent, at most %d allowed", len(items), limits.MaxCount)
+	}
+	if len(limits.AllowedTypes) == 0 {
+		limits.AllowedTypes = DefaultAllowedTypes
+	}
+
+	out := make([]protocol.ImageItem, 0, len(items))
+	for i, item := range items {
+		normalized, err := normalizeOne(item, limits)
+		if err != nil {
+			if e, ok := err.(*Error); ok {
+				e.Message = fmt.Sprintf("image %d: %s", i, e.Message)
+			}
+			return nil, err
+		}
+		out = append(out, normalized)
+	}
+	return out, nil
+}
+
+func normalizeOne(item protocol.ImageItem, limits Limits) (protocol.ImageItem, error) {
+	encoded := strings.TrimSpace(item.Data)
+	if i := strings.Index(encoded, ";base64,"); i >= 0 && strings.HasPrefix(encoded, "data:") {
+		encoded = encoded[i+len(";base64,"):]
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return protocol.ImageItem{}, errorf("IMAGE_BAD_BASE64", "invalid base64 data")
+	}
+	if len(raw) == 0 {
+		return protocol.ImageItem{}, errorf("IMAGE_EMPTY", "no image data")
+	}
+
+	mimeType := http.DetectContentType(raw)
+	if !allowed(limits.AllowedTypes, mimeType) {
+		return protocol.ImageItem{}, errorf("IMAGE_UNSUPPORTED_TYPE", "content is %s", mimeType)
+	}
+
+	width, height, err := dimensions(raw, mimeType)
+	if err != nil {
+		return protocol.ImageItem{}, errorf("IMAGE_DECODE_FAILED", "%s: %v", mimeType, err)
+	}
+	if width*height > maxPixels {
+		return protocol.ImageItem{}, errorf("IMAGE_DIMENSIONS_EXCEEDED", "%dx%d exceeds %d pixels", width, height, maxPixels)
+	}
+
+	tooWide := (limits.MaxWidth > 0 && width > limits.MaxWidth) || (limits.MaxHeight > 0 && height > limits.MaxHeight)
+	tooBig := limits.MaxBytes > 0 && int64(len(raw)) > limits.MaxBytes
+	forceFormat := limits.Reencode != "" && mimeType != "image/webp" && formatOf(mimeType) != limits.Reencode
+	if !tooWide && !tooBig && !forceFormat {
+		return protocol.ImageItem{Data: encoded, MimeType: mimeType}, nil
+	}
+
+	if (tooWide || tooBig) && !limits.Downscale {
+		if tooWide {
+			return protocol.ImageItem{}, errorf("IMAGE_DIMENSIONS_EXCEEDED", "%dx%d exceeds %dx%d", width, height, limits.MaxWidth, limits.MaxHeight)
+		}
+		return protocol.ImageItem{}, errorf("IMAGE_TOO_LARGE", "%d bytes exceeds %d", len(raw), limits.MaxBytes)
+	}
+	if mimeType == "image/webp" {
+		return protocol.ImageItem{}, errorf("IMAGE_UNSUPPORTED_TYPE", "webp images cannot be resized or re-encoded")
+	}
+
+	processed, outType, err := process(raw, limits)
+	if err != nil {
+		return protocol.ImageItem{}, err
+	}
+	return protocol.ImageItem{Data: base64.StdEncoding.EncodeToString(processed), MimeType: outType}, nil
+}
+
+// process decodes raw, fits it into the dimension limits and re-encodes it,
+// shrinking further until it also fits MaxBytes.
+func process(raw []byte, limits Limits) ([]byte, string, error) {
+	src, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", errorf("IMAGE_DECODE_FAILED", "%v", err)
+	}
+	outFormat := limits.Reencode
+	if outFormat == "" {
+		outFormat = format
+		if outFormat == "gif" {
+			outFormat = "png"
+		}
+	}
+
+	bounds := src.Bounds()
+	width, height := fitWithin(bounds.Dx(), bounds.Dy(), limits.MaxWidth, limits.MaxHeight)
+	for {
+		img := src
+		if width != bounds.Dx() || height != bounds.Dy() {
+			img = downscale(src, width, height)
+		}
+		out, err := encode(img, outFormat, limits.JPEGQuality)
+		if err != nil {
+			return nil, "", errorf("IMAGE_ENCODE_FAILED", "%v", err)
+		}
+		if limits.MaxBytes <= 0 || int64(len(out)) <= limits.MaxBytes {
+			return out, "image/" + outFormat, nil
+		}
+		if width <= 64 || height <= 64 {
+			return nil, "", errorf("IMAGE_TOO_LARGE", "cannot shrink below %d bytes", limits.MaxBytes)
+		}
+		width, height = width*3/4, height*3/4
+	}
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		if quality <= 0 {
+			quality = 85
+		}
+		if err := jpeg.Encode(&buf, flatten(img), &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+	case "png":
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", format)
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten composites img onto white, since JPEG has no alpha channel and
+// the encoder would otherwise drop it, turning transparent areas black.
+func flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, image.White, image.Point{}, draw.Src)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Over)
+	return out
+}
+
+func dimensions(raw []byte, mimeType string) (width, height int, err error) {
+	if mimeType == "image/webp" {
+		return webpDimensions(raw)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// fitWithin scales width x height down to fit the limits, keeping the aspect
+// ratio. Zero limits are unbounded.
+func fitWithin(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && height > maxHeight {
+		scale = min(scale, float64(maxHeight)/float64(height))
+	}
+	if scale == 1.0 {
+		return width, height
+	}
+	return max(1, int(float64(width)*scale)), max(1, int(float64(height)*scale))
+}
+
+func formatOf(mimeType string) string {
+	return strings.TrimPrefix(mimeType, "image/")
+}
+
+func allowed(types []string, mimeType string) bool {
+	for _, t := range types {
+		if strings.EqualFold(t, mimeType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+package images
+
+import (
+	"image"
+	"image/draw"
+)
+
+// downscale shrinks src to width x height with a box filter: every output
+// pixel is the average of the source pixels it covers.
+func downscale(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	in := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(in, in.Bounds(), src, bounds.Min, draw.Src)
+
+	srcW, srcH := in.Rect.Dx(), in.Rect.Dy()
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcH / height
+		y1 := max(y0+1, (y+1)*srcH/height)
+		for x := 0; x < width; x++ {
+			x0 := x * srcW / width
+			x1 := max(x0+1, (x+1)*srcW/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := in.Pix[sy*in.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			o := out.Pix[y*out.Stride+x*4:]
+			o[0] = uint8(r / n)
+			o[1] = uint8(g / n)
+			o[2] = uint8(b / n)
+			o[3] = uint8(a / n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package images
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errBadWebP = errors.New("invalid webp header")
+
+// webpDimensions reads the canvas size from a RIFF WebP header (lossy VP8,
+// lossless VP8L or extended VP8X) without decoding the image.
+func webpDimensions(raw []byte) (width, height int, err error) {
+	if len(raw) < 30 || string(raw[0:4]) != "RIFF" || string(raw[8:12]) != "WEBP" {
+		return 0, 0, errBadWebP
+	}
+	chunk := raw[20:]
+	switch string(raw[12:16]) {
+	case "VP8 ":
+		// Frame tag (3 bytes), start code 9d 01 2a, then 14-bit sizes.
+		if len(chunk) < 10 || chunk[3] != 0x9d || chunk[4] != 0x01 || chunk[5] != 0x2a {
+			return 0, 0, errBadWebP
+		}
+		width = int(binary.LittleEndian.Uint16(chunk[6:8]) & 0x3fff)
+		height = int(binary.LittleEndian.Uint16(chunk[8:10]) & 0x3fff)
+	case "VP8L":
+		if len(chunk) < 5 || chunk[0] != 0x2f {
+			return 0, 0, errBadWebP
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:5])
+		width = int(bits&0x3fff) + 1
+		height = int((bits>>14)&0x3fff) + 1
+	case "VP8X":
+		if len(chunk) < 10 {
+			return 0, 0, errBadWebP
+		}
+		width = int(uint32(chunk[4])|uint32(chunk[5])<<8|uint32(chunk[6])<<16) + 1
+		height = int(uint32(chunk[7])|uint32(chunk[8])<<8|uint32(chunk[9])<<16) + 1
+	default:
+		return 0, 0, errBadWebP
+	}
+	return width, height, nil
+}
@@ -0,0 +1,443 @@
+// Package mockgateway is a stand-in for the OpenClaw Gateway, for local
+// development and tests. It speaks the handshake gatewayclient expects
+// (connect.challenge, connect), answers agent and chat.abort requests and
+// streams replies as chat or agent events, with optional fault injection.
+package mockgateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Event shapes used to stream replies.
+const (
+	// ShapeChat streams chat events with state delta and final.
+	ShapeChat = "chat"
+	// ShapeAgent streams agent assistant deltas between lifecycle start
+	// and end, finished by a chat final event as OpenClaw does.
+	ShapeAgent = "agent"
+)
+
+type Options struct {
+	// Token is the auth token clients must present. Empty accepts any.
+	Token string
+	// Shape selects ShapeChat (default) or ShapeAgent events.
+	Shape string
+	// Script is streamed as the reply to every message. Empty echoes the
+	// message word by word.
+	Script []string
+	Faults Faults
+	Logger *log.Logger
+}
+
+// Faults are failures the server injects. They can be changed while it runs
+// with SetFaults.
+type Faults struct {
+	// AuthFail rejects every connect request as unauthorized.
+	AuthFail bool
+	// TokenDelay is the pause before each streamed chunk.
+	TokenDelay time.Duration
+	// AcceptDelay is the pause before an agent request is answered with
+	// its run id.
+	AcceptDelay time.Duration
+	// DisconnectAfter closes the connection after that many chunks of a
+	// run. Zero never disconnects.
+	DisconnectAfter int
+	// Malformed sends an invalid frame, a binary frame and an event with a
+	// mistyped payload before every chunk.
+	Malformed bool
+	// RunError finishes runs with a chat error event instead of final.
+	RunError bool
+	// DropFinal never sends the terminal event of a run.
+	DropFinal bool
+	// Stray sends a delta for a run and session the client never started
+	// before every chunk.
+	Stray bool
+}
+
+type Server struct {
+	opts     Options
+	logger   *log.Logger
+	upgrader websocket.Upgrader
+
+	mu     sync.Mutex
+	faults Faults
+	conns  map[*conn]struct{}
+
+	nextRun atomic.Int64
+	runs    atomic.Int64
+	aborts  atomic.Int64
+}
+
+type frame struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	OK      *bool           `json:"ok,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Payload any             `json:"payload,omitempty"`
+	Error   *frameError     `json:"error,omitempty"`
+}
+
+type frameError struct {
+	Message string `json:"message"`
+}
+
+func New(opts Options) *Server {
+	if opts.Shape == "" {
+		opts.Shape = ShapeChat
+	}
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Server{
+		opts:   opts,
+		logger: logger,
+		upgrader: websocket.Upgrader{
+			CheckOrigin:       func(_ *http.Request) bool { return true },
+			EnableCompression: true,
+		},
+		faults: opts.Faults,
+		conns:  make(map[*conn]struct{}),
+	}
+}
+
+// SetFaults replaces the injected faults. Runs in progress pick up the new
+// values at their next chunk.
+func (s *Server) SetFaults(f Faults) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+}
+
+func (s *Server) currentFaults() Faults {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.faults
+}
+
+// DisconnectAll closes every client connection, as a gateway restart would.
+func (s *Server) DisconnectAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		_ = c.ws.Close()
+	}
+}
+
+// Connections reports how many clients are connected.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
+// Runs reports how many agent requests were accepted.
+func (s *Server) Runs() int64 {
+	return s.runs.Load()
+}
+
+// Aborts reports how many runs were stopped by chat.abort.
+func (s *Server) Aborts() int64 {
+	return s.aborts.Load()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ws, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Printf("upgrade error=%v", err)
+		return
+	}
+	c := &conn{server: s, ws: ws, runs: make(map[string]*run)}
+	s.mu.Lock()
+	s.conns[c] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.stopRuns()
+		_ = ws.Close()
+	}()
+
+	c.serve()
+}
+
+// conn is one client connection.
+type conn struct {
+	server *Server
+	ws     *websocket.Conn
+
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	runs map[string]*run
+}
+
+type run struct {
+	id         string
+	sessionKey string
+	stop       chan struct{}
+	once       sync.Once
+}
+
+func (r *run) abort() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+func (c *conn) serve() {
+	s := c.server
+	if err := c.send(frame{Type: "event", Event: "connect.challenge", Payload: map[string]any{
+		"nonce": fmt.Sprintf("%x", time.Now().UnixNano()),
+		"ts":    time.Now().UnixMilli(),
+	}}); err != nil {
+		return
+	}
+
+	connected := false
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var req frame
+		if err := json.Unmarshal(data, &req); err != nil || req.Type != "req" {
+			continue
+		}
+
+		switch {
+		case req.Method == "connect":
+			var params struct {
+				Auth struct {
+					Token string `json:"token"`
+				} `json:"auth"`
+				Client struct {
+					ID string `json:"id"`
+				} `json:"client"`
+			}
+			_ = json.Unmarshal(req.Params, &params)
+			if s.currentFaults().AuthFail || (s.opts.Token != "" && params.Auth.Token != s.opts.Token) {
+				s.logger.Printf("connect rejected client=%s", params.Client.ID)
+				_ = c.respondError(req.ID, "unauthorized: invalid gateway token")
+				return
+			}
+			connected = true
+			s.logger.Printf("connect ok client=%s", params.Client.ID)
+			_ = c.respond(req.ID, map[string]any{"type": "hello-ok", "protocol": 3})
+		case !connected:
+			_ = c.respondError(req.ID, "connect required")
+		case req.Method == "agent":
+			c.startRun(req)
+		case req.Method == "chat.abort":
+			c.abortRuns(req)
+		default:
+			_ = c.respondError(req.ID, "unknown method "+req.Method)
+		}
+	}
+}
+
+func (c *conn) startRun(req frame) {
+	var params struct {
+		SessionKey     string `json:"sessionKey"`
+		Message        string `json:"message"`
+		IdempotencyKey string `json:"idempotencyKey"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil || params.SessionKey == "" {
+		_ = c.respondError(req.ID, "invalid agent params")
+		return
+	}
+
+	s := c.server
+	r := &run{
+		id:         fmt.Sprintf("run_%d", s.nextRun.Add(1)),
+		sessionKey: params.SessionKey,
+		stop:       make(chan struct{}),
+	}
+	c.mu.Lock()
+	c.runs[r.id] = r
+	c.mu.Unlock()
+	s.runs.Add(1)
+	s.logger.Printf("agent run=%s session_key=%s bytes=%d", r.id, r.sessionKey, len(params.Message))
+
+	go func() {
+		if delay := s.currentFaults().AcceptDelay; delay > 0 {
+			time.Sleep(delay)
+		}
+		if err := c.respond(req.ID, map[string]any{"runId": r.id, "status": "accepted"}); err != nil {
+			return
+		}
+		c.stream(r, params.Message)
+	}()
+}
+
+func (c *conn) abortRuns(req frame) {
+	var params struct {
+		SessionKey string `json:"sessionKey"`
+		RunID      string `json:"runId"`
+	}
+	_ = json.Unmarshal(req.Params, &params)
+
+	aborted := 0
+	c.mu.Lock()
+	for id, r := range c.runs {
+		if r.sessionKey == params.SessionKey && (params.RunID == "" || params.RunID == id) {
+			r.abort()
+			aborted++
+		}
+	}
+	c.mu.Unlock()
+	c.server.aborts.Add(int64(aborted))
+	c.server.logger.Printf("chat.abort session_key=%s run=%s aborted=%d", params.SessionKey, params.RunID, aborted)
+	_ = c.respond(req.ID, map[string]any{"aborted": aborted > 0})
+}
+
+func (c *conn) stopRuns() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, r := range c.runs {
+		r.abort()
+	}
+}
+
+// stream sends the reply to one agent request.
+func (c *conn) stream(r *run, message string) {
+	s := c.server
+	defer func() {
+		c.mu.Lock()
+		delete(c.runs, r.id)
+		c.mu.Unlock()
+	}()
+
+	chunks := s.opts.Script
+	if len(chunks) == 0 {
+		for _, word := range strings.Fields(message) {
+			chunks = append(chunks, word+" ")
+		}
+	}
+
+	if s.opts.Shape == ShapeAgent {
+		_ = c.event("agent", r, map[string]any{"stream": "lifecycle", "data": map[string]any{"phase": "start"}})
+	}
+	for i, chunk := range chunks {
+		faults := s.currentFaults()
+		if faults.TokenDelay > 0 {
+			select {
+			case <-r.stop:
+				c.finish(r, "aborted", len(message), i)
+				return
+			case <-time.After(faults.TokenDelay):
+			}
+		}
+		select {
+		case <-r.stop:
+			c.finish(r, "aborted", len(message), i)
+			return
+		default:
+		}
+		if faults.DisconnectAfter > 0 && i >= faults.DisconnectAfter {
+			s.logger.Printf("fault disconnect run=%s after=%d", r.id, i)
+			_ = c.ws.Close()
+			return
+		}
+		if faults.Malformed {
+			c.sendMalformed(r)
+		}
+		if faults.Stray {
+			c.sendStray()
+		}
+
+		var err error
+		if s.opts.Shape == ShapeAgent {
+			err = c.event("agent", r, map[string]any{"stream": "assistant", "data": map[string]any{"delta": chunk}})
+		} else {
+			err = c.event("chat", r, map[string]any{"state": "delta", "message": map[string]any{
+				"role":    "assistant",
+				"content": []any{map[string]any{"type": "text", "text": chunk}},
+			}})
+		}
+		if err != nil {
+			return
+		}
+	}
+	c.finish(r, "stop", len(message), len(chunks))
+}
+
+// finish sends the terminal events of a run.
+func (c *conn) finish(r *run, stopReason string, inputBytes, outputChunks int) {
+	faults := c.server.currentFaults()
+	if faults.DropFinal {
+		return
+	}
+	if c.server.opts.Shape == ShapeAgent {
+		_ = c.event("agent", r, map[string]any{"stream": "lifecycle", "data": map[string]any{"phase": "end"}})
+	}
+	switch {
+	case stopReason == "aborted":
+		_ = c.event("chat", r, map[string]any{"state": "aborted", "stopReason": "aborted"})
+	case faults.RunError:
+		_ = c.event("chat", r, map[string]any{"state": "error", "error": map[string]any{"message": "mock run failed"}})
+	default:
+		_ = c.event("chat", r, map[string]any{"state": "final", "message": map[string]any{
+			"role":       "assistant",
+			"model":      "mock",
+			"provider":   "mockgateway",
+			"stopReason": stopReason,
+			"usage":      map[string]any{"input": inputBytes / 4, "output": outputChunks},
+		}})
+	}
+}
+
+// sendMalformed sends frames a robust client must ignore.
+func (c *conn) sendMalformed(r *run) {
+	c.writeMu.Lock()
+	_ = c.ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"event","event":`))
+	_ = c.ws.WriteMessage(websocket.BinaryMessage, []byte{0xff, 0x00})
+	c.writeMu.Unlock()
+	_ = c.send(frame{Type: "event", Event: "chat", Payload: map[string]any{
+		"runId": r.id, "sessionKey": r.sessionKey, "state": []int{1}, "message": 42,
+	}})
+}
+
+// sendStray sends a chat delta no request of the client correlates with.
+func (c *conn) sendStray() {
+	_ = c.send(frame{Type: "event", Event: "chat", Payload: map[string]any{
+		"runId": "run_stray", "sessionKey": "agent:main:stray", "state": "delta",
+		"message": map[string]any{"role": "assistant", "content": []any{map[string]any{"type": "text", "text": "stray "}}},
+	}})
+}
+
+func (c *conn) event(name string, r *run, payload map[string]any) error {
+	payload["runId"] = r.id
+	payload["sessionKey"] = r.sessionKey
+	return c.send(frame{Type: "event", Event: name, Payload: payload})
+}
+
+func (c *conn) respond(id string, payload any) error {
+	ok := true
+	return c.send(frame{Type: "res", ID: id, OK: &ok, Payload: payload})
+}
+
+func (c *conn) respondError(id, message string) error {
+	ok := false
+	return c.send(frame{Type: "res", ID: id, OK: &ok, Error: &frameError{Message: message}})
+}
+
+func (c *conn) send(f frame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
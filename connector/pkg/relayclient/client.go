@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"log"
+	"net/http"
 	"sync"
 	"time"
 
@@ -13,6 +14,13 @@ import (
 	"openclaw-bridge/shared/protocol"
 )
 
+// dialer is websocket.DefaultDialer with permessage-deflate enabled.
+var dialer = &websocket.Dialer{
+	Proxy:             http.ProxyFromEnvironment,
+	HandshakeTimeout:  45 * time.Second,
+	EnableCompression: true,
+}
+
 type OnControlFunc func(protocol.ControlMessage)
 type OnDataFunc func(sessionID string, flags byte, payload []byte)
 
@@ -60,7 +68,7 @@ func (c *Client) Run(ctx context.Context) error {
 }
 
 func (c *Client) connectAndServe(ctx context.Context) error {
-	conn, _, err := websocket.DefaultDialer.Dial(c.cfg.RelayURL, nil)
+	conn, _, err := dialer.Dial(c.cfg.RelayURL, nil)
 	if err != nil {
 		return err
 	}
@@ -79,7 +87,12 @@ func (c *Client) connectAndServe(ctx context.Context) error {
 		Type:           protocol.TypeRegister,
 		AccessCodeHash: c.cfg.AccessCodeHash,
 		Generation:     1,
-		Caps:           &protocol.Caps{E2EE: false},
+		Versions:       protocol.SupportedVersions,
+		Caps: &protocol.Caps{
+			Events:      protocol.OptionalEvents,
+			Attachments: true,
+			Compression: protocol.SupportedCompression,
+		},
 	}); err != nil {
 		c.closeConn()
 		return err
@@ -138,18 +151,20 @@ func (c *Client) SendControl(msg protocol.ControlMessage) error {
 	if err != nil {
 		return err
 	}
-	return c.write(websocket.TextMessage, data)
+	return c.write(websocket.TextMessage, data, true)
 }
 
+// SendData sends a DATA frame. Payloads that are already compressed or
+// encrypted skip permessage-deflate.
 func (c *Client) SendData(sessionID string, flags byte, payload []byte) error {
 	frame, err := protocol.BuildDataFrame(sessionID, flags, payload)
 	if err != nil {
 		return err
 	}
-	return c.write(websocket.BinaryMessage, frame)
+	return c.write(websocket.BinaryMessage, frame, protocol.WireCompressible(flags))
 }
 
-func (c *Client) write(msgType int, data []byte) error {
+func (c *Client) write(msgType int, data []byte, compress bool) error {
 	conn := c.getConn()
 	if conn == nil {
 		return errors.New("relay not connected")
@@ -157,6 +172,7 @@ func (c *Client) write(msgType int, data []byte) error {
 
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
+	conn.EnableWriteCompression(compress)
 	return conn.WriteMessage(msgType, data)
 }
 
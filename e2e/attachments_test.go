@@ -0,0 +1,35 @@
+package e2e
+
+import (
+	"testing"
+
+	"openclaw-bridge/shared/protocol"
+)
+
+func TestAttachmentUpload(t *testing.T) {
+	h := Start(t, Options{})
+	c := h.MustConnect(t)
+
+	data := []byte("quarterly numbers, plain text")
+	for _, chunk := range protocol.SplitAttachment("a1", data, 8) {
+		c.SendChunk(t, chunk)
+	}
+	msg := userMessage("m1", "summarise")
+	msg.Attachments = []protocol.AttachmentRef{{ID: "a1", MimeType: "text/plain", Name: "q.txt", Size: int64(len(data))}}
+	c.Send(t, msg)
+	if _, end := c.Reply(t); end.Type != protocol.EventEnd || end.ID != "m1" {
+		t.Fatalf("terminal event = %+v, want end for m1", end)
+	}
+
+	// A chunk that skips ahead is rejected with the attachment id.
+	c.SendChunk(t, protocol.AttachmentChunk{ID: "a2", Offset: 4, Data: []byte("late"), Final: true})
+	if ev := c.Next(t); ev.Type != protocol.EventError || ev.Code != "ATTACHMENT_BAD_OFFSET" || ev.ID != "a2" {
+		t.Fatalf("bad offset: got %+v, want ATTACHMENT_BAD_OFFSET for a2", ev)
+	}
+
+	// The consumed upload cannot be referenced again.
+	c.Send(t, msg)
+	if ev := c.Next(t); ev.Type != protocol.EventError || ev.Code != "ATTACHMENT_NOT_FOUND" || ev.ID != "m1" {
+		t.Fatalf("reused attachment: got %+v, want ATTACHMENT_NOT_FOUND for m1", ev)
+	}
+}
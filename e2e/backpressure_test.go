@@ -0,0 +1,102 @@
+package e2e
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/connector/pkg/mockgateway"
+	"openclaw-bridge/relay/pkg/server"
+	"openclaw-bridge/shared/protocol"
+)
+
+// stalledClient opens a session and sends count user messages without ever
+// reading the replies. Its socket buffers little, so the replies pile up in
+// the relay rather than in the kernel.
+func stalledClient(t *testing.T, h *Harness, count int) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{NetDial: func(network, addr string) (net.Conn, error) {
+		conn, err := net.Dial(network, addr)
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			_ = tcp.SetReadBuffer(16 << 10)
+		}
+		return conn, err
+	}}
+	conn, _, err := dialer.Dial(h.ClientURL(), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	connect, _ := protocol.EncodeControl(protocol.ControlMessage{Type: protocol.TypeConnect, AccessCode: h.AccessCode})
+	if err := conn.WriteMessage(websocket.TextMessage, connect); err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read CONNECT_OK: %v", err)
+	}
+	ok, err := protocol.DecodeControl(data)
+	if err != nil || ok.Type != protocol.TypeConnectOK {
+		t.Fatalf("handshake reply %s: %v", data, err)
+	}
+	for i := 0; i < count; i++ {
+		payload, _ := protocol.EncodeEvent(userMessage("flood", "go"))
+		frame, _ := protocol.BuildDataFrame(ok.SessionID, 0, payload)
+		if err := conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+	return conn
+}
+
+// slowClientTimeout bounds each wait in TestSlowClientDoesNotStallOthers.
+// The connector works through the flood before the other session's
+// messages, which takes a while under the race detector.
+const slowClientTimeout = 60 * time.Second
+
+func TestSlowClientDoesNotStallOthers(t *testing.T) {
+	// Replies too large and random for kernel buffers or compression to
+	// absorb them all: the 8 MiB flood outgrows the queue plus a socket
+	// send buffer of up to 4 MiB.
+	letters := make([]byte, 128<<10)
+	rng := rand.New(rand.NewSource(1))
+	for i := range letters {
+		letters[i] = byte('a' + rng.Intn(26))
+	}
+	h := Start(t, Options{
+		Relay:   server.Options{QueueBytes: 1 << 20, WriteTimeout: 500 * time.Millisecond},
+		Gateway: mockgateway.Options{Script: []string{string(letters)}},
+	})
+
+	stalled := stalledClient(t, h, 64)
+
+	sess := dial(t, h, client.Options{})
+	for _, id := range []string{"m1", "m2", "m3"} {
+		if err := sess.Send(userMessage(id, "still served")); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+		if content, end := replyWithin(t, sess, id, slowClientTimeout); end.Type != protocol.EventEnd || len(content) != len(letters) {
+			t.Fatalf("%s: reply of %d bytes %+v", id, len(content), end)
+		}
+	}
+
+	// The relay gave up on the stalled client: draining what reached its
+	// socket ends in a closed connection, not a timeout.
+	_ = stalled.SetReadDeadline(time.Now().Add(slowClientTimeout))
+	for {
+		_, _, err := stalled.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatal("stalled client was not disconnected")
+		}
+		break
+	}
+}
@@ -0,0 +1,220 @@
+package e2e
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/connector/pkg/mockgateway"
+	"openclaw-bridge/shared/protocol"
+)
+
+func dial(t *testing.T, h *Harness, opts client.Options) *client.Session {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	sess, err := client.Dial(ctx, h.ClientURL(), h.AccessCode, opts)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = sess.Close() })
+	return sess
+}
+
+// reply collects token content until the end or error event for id.
+func reply(t *testing.T, sess *client.Session, id string) (string, protocol.Event) {
+	t.Helper()
+	return replyWithin(t, sess, id, Timeout)
+}
+
+// replyWithin is reply with a deadline of its own.
+func replyWithin(t *testing.T, sess *client.Session, id string, wait time.Duration) (string, protocol.Event) {
+	t.Helper()
+	var content strings.Builder
+	timeout := time.After(wait)
+	for {
+		select {
+		case ev, ok := <-sess.Events():
+			if !ok {
+				t.Fatalf("events closed: %v", sess.Err())
+			}
+			if ev.ID != id {
+				continue
+			}
+			switch ev.Type {
+			case protocol.EventToken:
+				content.WriteString(ev.Content)
+			case protocol.EventEnd, protocol.EventError:
+				return content.String(), ev
+			}
+		case <-timeout:
+			t.Fatalf("no terminal event for %s within %s", id, wait)
+		}
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	h := Start(t, Options{})
+	sess := dial(t, h, client.Options{})
+	if sess.ID() == "" {
+		t.Fatal("empty session id")
+	}
+
+	if err := sess.Send(userMessage("m1", "hello from the sdk")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	content, end := reply(t, sess, "m1")
+	if end.Type != protocol.EventEnd || content != "hello from the sdk " {
+		t.Fatalf("reply = %q %+v", content, end)
+	}
+}
+
+func TestClientStop(t *testing.T) {
+	h := Start(t, Options{})
+	h.Gateway.SetFaults(mockgateway.Faults{TokenDelay: 50 * time.Millisecond})
+	sess := dial(t, h, client.Options{})
+
+	if err := sess.Send(userMessage("m1", strings.Repeat("word ", 100))); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if first := <-sess.Events(); first.Type != protocol.EventToken {
+		t.Fatalf("first event = %+v, want token", first)
+	}
+	if err := sess.Stop("m1"); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	_, end := reply(t, sess, "m1")
+	if end.Type != protocol.EventEnd || end.Meta == nil || end.Meta.StopReason != "aborted" {
+		t.Fatalf("terminal event = %+v, want aborted end", end)
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	h := Start(t, Options{})
+	h.Gateway.SetFaults(mockgateway.Faults{TokenDelay: 50 * time.Millisecond})
+	reconnected := make(chan string, 1)
+	sess := dial(t, h, client.Options{
+		Reconnect:      true,
+		ReconnectDelay: 50 * time.Millisecond,
+		OnReconnect:    func(sessionID string) { reconnected <- sessionID },
+	})
+	first := sess.ID()
+
+	if err := sess.Send(userMessage("m1", strings.Repeat("word ", 100))); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if ev := <-sess.Events(); ev.Type != protocol.EventToken {
+		t.Fatalf("first event = %+v, want token", ev)
+	}
+	h.DropRelayConnections()
+
+	// The run in flight fails locally instead of hanging.
+	if _, end := reply(t, sess, "m1"); end.Type != protocol.EventError || end.Code != "CONNECTION_LOST" {
+		t.Fatalf("terminal event = %+v, want CONNECTION_LOST", end)
+	}
+	select {
+	case id := <-reconnected:
+		if id == first || id != sess.ID() {
+			t.Fatalf("reconnected session %q, first %q, current %q", id, first, sess.ID())
+		}
+	case <-time.After(Timeout):
+		t.Fatal("no reconnect")
+	}
+
+	h.Gateway.SetFaults(mockgateway.Faults{})
+	if err := sess.Send(userMessage("m2", "after reconnect")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if content, end := reply(t, sess, "m2"); end.Type != protocol.EventEnd || content != "after reconnect " {
+		t.Fatalf("reply = %q %+v", content, end)
+	}
+}
+
+func TestClientUnrelatedErrorKeepsRunInFlight(t *testing.T) {
+	h := Start(t, Options{})
+	h.Gateway.SetFaults(mockgateway.Faults{TokenDelay: 50 * time.Millisecond})
+	sess := dial(t, h, client.Options{Reconnect: true, ReconnectDelay: 50 * time.Millisecond})
+
+	// Neither the message nor the unsupported event carries an id; the
+	// error answering the latter must not end the former.
+	if err := sess.Send(userMessage("", strings.Repeat("word ", 100))); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if err := sess.Send(protocol.Event{Type: "bogus"}); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if _, end := reply(t, sess, ""); end.Code != "UNSUPPORTED_EVENT" {
+		t.Fatalf("terminal event = %+v, want UNSUPPORTED_EVENT", end)
+	}
+	h.DropRelayConnections()
+
+	if _, end := reply(t, sess, ""); end.Type != protocol.EventError || end.Code != "CONNECTION_LOST" {
+		t.Fatalf("terminal event = %+v, want CONNECTION_LOST", end)
+	}
+}
+
+func TestClientSendWhileReconnecting(t *testing.T) {
+	h := Start(t, Options{})
+	disconnected := make(chan struct{}, 1)
+	sess := dial(t, h, client.Options{
+		Reconnect:      true,
+		ReconnectDelay: Timeout,
+		OnDisconnect:   func(error) { disconnected <- struct{}{} },
+	})
+
+	h.DropRelayConnections()
+	select {
+	case <-disconnected:
+	case <-time.After(Timeout):
+		t.Fatal("no disconnect")
+	}
+
+	if err := sess.Stop(""); !errors.Is(err, client.ErrDisconnected) {
+		t.Errorf("stop: err = %v, want ErrDisconnected", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := sess.SendContext(ctx, userMessage("m1", "waits")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("send: err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestClientSessionEnd(t *testing.T) {
+	h := Start(t, Options{})
+
+	t.Run("close", func(t *testing.T) {
+		sess := dial(t, h, client.Options{})
+		if err := sess.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		h.Connector().WaitControl(t, protocol.TypeCloseSession, sess.ID())
+		if _, ok := <-sess.Events(); ok || sess.Err() != nil {
+			t.Errorf("events open=%v err=%v after close", ok, sess.Err())
+		}
+		if err := sess.Send(userMessage("m1", "too late")); !errors.Is(err, client.ErrClosed) {
+			t.Errorf("send after close = %v, want ErrClosed", err)
+		}
+	})
+
+	t.Run("relay closes session", func(t *testing.T) {
+		sess := dial(t, h, client.Options{})
+		h.Connector().Stop()
+		select {
+		case <-sess.Done():
+		case <-time.After(Timeout):
+			t.Fatal("session still open")
+		}
+		if !errors.Is(sess.Err(), client.ErrSessionClosed) {
+			t.Errorf("err = %v, want ErrSessionClosed", sess.Err())
+		}
+
+		_, err := client.Dial(context.Background(), h.ClientURL(), h.AccessCode, client.Options{})
+		var connectErr *client.ConnectError
+		if !errors.As(err, &connectErr) || connectErr.Code != "CONNECTOR_NOT_FOUND" {
+			t.Fatalf("dial without connector: %v, want CONNECTOR_NOT_FOUND", err)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package e2e
+
+import (
+	"strings"
+	"testing"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/connector/pkg/mockgateway"
+	"openclaw-bridge/shared/protocol"
+)
+
+func TestPayloadCompression(t *testing.T) {
+	script := strings.Repeat("compressible ", 1000)
+	h := Start(t, Options{Gateway: mockgateway.Options{Script: []string{script}}})
+	sess := dial(t, h, client.Options{})
+	caps := sess.Caps()
+	if got := caps.CompressionAlgorithm(); got != protocol.CompressionDeflate {
+		t.Fatalf("negotiated compression = %q, want deflate", got)
+	}
+	before := h.Relay.Metrics().CompressedFrames
+
+	if err := sess.Send(userMessage("m1", strings.Repeat("hello ", 2000))); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	content, end := reply(t, sess, "m1")
+	if end.Type != protocol.EventEnd || content != script {
+		t.Fatalf("reply = %d bytes %+v, want the %d byte script", len(content), end, len(script))
+	}
+	// The user message and the script token cross the relay compressed.
+	if n := h.Relay.Metrics().CompressedFrames - before; n < 2 {
+		t.Errorf("compressed frames = %d, want at least 2", n)
+	}
+}
+
+func TestWireCompression(t *testing.T) {
+	h := Start(t, Options{Gateway: mockgateway.Options{Script: []string{"ok"}}})
+	// The harness client predates negotiation and compresses nothing itself,
+	// so only permessage-deflate between relay and connector applies.
+	c := h.MustConnect(t)
+	c.Send(t, userMessage("m1", strings.Repeat("hello ", 20000)))
+	if _, end := c.Reply(t); end.Type != protocol.EventEnd {
+		t.Fatalf("terminal event = %+v, want end", end)
+	}
+
+	m := h.Relay.Metrics()
+	if m.LogicalBytesOut < 120000 || m.WireBytesOut >= m.LogicalBytesOut/2 {
+		t.Errorf("relay wrote %d logical bytes as %d wire bytes, want permessage-deflate to shrink them", m.LogicalBytesOut, m.WireBytesOut)
+	}
+	if m.WireBytesIn < m.LogicalBytesIn {
+		t.Errorf("relay read %d logical bytes as %d wire bytes, want no less from an uncompressed client", m.LogicalBytesIn, m.WireBytesIn)
+	}
+}
@@ -0,0 +1,200 @@
+package e2e
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"openclaw-bridge/connector/pkg/mockgateway"
+	"openclaw-bridge/shared/protocol"
+)
+
+func userMessage(id, content string) protocol.Event {
+	return protocol.Event{Type: protocol.EventUserMessage, ID: id, Content: content}
+}
+
+func TestConnectAndStream(t *testing.T) {
+	h := Start(t, Options{})
+	c := h.MustConnect(t)
+
+	c.Send(t, userMessage("m1", "hello over the bridge"))
+	content, end := c.Reply(t)
+	if end.Type != protocol.EventEnd {
+		t.Fatalf("terminal event = %+v, want end", end)
+	}
+	if content != "hello over the bridge " {
+		t.Errorf("content = %q", content)
+	}
+	if end.ID != "m1" {
+		t.Errorf("end id = %q, want m1", end.ID)
+	}
+	if end.Meta == nil || end.Meta.Model != "mock" || end.Meta.StopReason != "stop" || end.Meta.RunID == "" {
+		t.Errorf("end meta = %+v", end.Meta)
+	}
+}
+
+func TestAgentShapeAndMalformedFrames(t *testing.T) {
+	h := Start(t, Options{Gateway: mockgateway.Options{
+		Shape:  mockgateway.ShapeAgent,
+		Faults: mockgateway.Faults{Malformed: true},
+	}})
+	c := h.MustConnect(t)
+
+	c.Send(t, userMessage("m1", "agent events survive garbage"))
+	content, end := c.Reply(t)
+	if end.Type != protocol.EventEnd || content != "agent events survive garbage " {
+		t.Fatalf("reply = %q %+v", content, end)
+	}
+}
+
+func TestUncorrelatedEventsDropped(t *testing.T) {
+	h := Start(t, Options{})
+	h.Gateway.SetFaults(mockgateway.Faults{Stray: true})
+	c := h.MustConnect(t)
+	before := h.Connector().DroppedEvents()
+
+	c.Send(t, userMessage("m1", "only my words"))
+	content, end := c.Reply(t)
+	if end.Type != protocol.EventEnd || content != "only my words " {
+		t.Fatalf("reply = %q %+v", content, end)
+	}
+	// One stray delta before each of the three chunks.
+	if n := h.Connector().DroppedEvents() - before; n != 3 {
+		t.Errorf("dropped events = %d, want 3", n)
+	}
+}
+
+func TestStop(t *testing.T) {
+	h := Start(t, Options{})
+	h.Gateway.SetFaults(mockgateway.Faults{TokenDelay: 50 * time.Millisecond})
+	c := h.MustConnect(t)
+
+	c.Send(t, userMessage("m1", strings.Repeat("word ", 100)))
+	if first := c.Next(t); first.Type != protocol.EventToken {
+		t.Fatalf("first event = %+v, want token", first)
+	}
+	c.Send(t, protocol.Event{Type: "control", Action: "stop", ID: "m1"})
+
+	_, end := c.Reply(t)
+	if end.Type != protocol.EventEnd || end.Meta == nil || end.Meta.StopReason != "aborted" {
+		t.Fatalf("terminal event = %+v meta=%+v, want aborted end", end, end.Meta)
+	}
+	if n := h.Gateway.Aborts(); n != 1 {
+		t.Errorf("gateway aborts = %d, want 1", n)
+	}
+}
+
+func TestStopBeforeRunID(t *testing.T) {
+	h := Start(t, Options{})
+	h.Gateway.SetFaults(mockgateway.Faults{AcceptDelay: 300 * time.Millisecond, TokenDelay: 20 * time.Millisecond})
+	c := h.MustConnect(t)
+
+	// m1 is stopped before the gateway reports its run id; the abort must
+	// wait for it rather than stop every run of the session.
+	c.Send(t, userMessage("m1", strings.Repeat("word ", 50)))
+	c.Send(t, userMessage("m2", "runs to the end"))
+	c.Send(t, protocol.Event{Type: "control", Action: "stop", ID: "m1"})
+
+	ends := map[string]protocol.Event{}
+	for len(ends) < 2 {
+		_, end := c.Reply(t)
+		ends[end.ID] = end
+	}
+	if end := ends["m1"]; end.Type != protocol.EventEnd || end.Meta == nil || end.Meta.StopReason != "aborted" {
+		t.Errorf("m1 terminal event = %+v meta=%+v, want aborted end", end, end.Meta)
+	}
+	if end := ends["m2"]; end.Type != protocol.EventEnd || end.Meta == nil || end.Meta.StopReason != "stop" {
+		t.Errorf("m2 terminal event = %+v meta=%+v, want completed end", end, end.Meta)
+	}
+	if n := h.Gateway.Aborts(); n != 1 {
+		t.Errorf("gateway aborts = %d, want 1", n)
+	}
+}
+
+func TestConnectorReplacement(t *testing.T) {
+	h := Start(t, Options{})
+	first := h.Connector()
+	c := h.MustConnect(t)
+
+	h.StartConnector()
+	if msg := c.WaitControl(t, protocol.TypeCloseSession); msg.SessionID != c.SessionID {
+		t.Fatalf("CLOSE_SESSION for %q, want %q", msg.SessionID, c.SessionID)
+	}
+	// The replaced connector would reconnect and take the access code back.
+	first.Stop()
+
+	c2 := h.MustConnect(t)
+	c2.Send(t, userMessage("m1", "served by the new connector"))
+	if _, end := c2.Reply(t); end.Type != protocol.EventEnd {
+		t.Fatalf("terminal event = %+v, want end", end)
+	}
+}
+
+func TestGatewayDisconnect(t *testing.T) {
+	h := Start(t, Options{})
+	h.Gateway.SetFaults(mockgateway.Faults{DisconnectAfter: 2})
+	c := h.MustConnect(t)
+
+	c.Send(t, userMessage("m1", "one two three four"))
+	_, end := c.Reply(t)
+	if end.Type != protocol.EventError || end.Code != "GATEWAY_DISCONNECTED" {
+		t.Fatalf("terminal event = %+v, want GATEWAY_DISCONNECTED", end)
+	}
+
+	// Messages sent while the gateway reconnects are queued and answered.
+	h.Gateway.SetFaults(mockgateway.Faults{})
+	c.Send(t, userMessage("m2", "after reconnect"))
+	content, end := c.Reply(t)
+	if end.Type != protocol.EventEnd || content != "after reconnect " {
+		t.Fatalf("reply = %q %+v", content, end)
+	}
+}
+
+func TestSessionClosePropagation(t *testing.T) {
+	h := Start(t, Options{})
+	connector := h.Connector()
+
+	t.Run("close session", func(t *testing.T) {
+		c := h.MustConnect(t)
+		c.SendControl(t, protocol.ControlMessage{Type: protocol.TypeCloseSession, SessionID: c.SessionID})
+		connector.WaitControl(t, protocol.TypeCloseSession, c.SessionID)
+		c.WaitControl(t, protocol.TypeCloseSession)
+	})
+
+	t.Run("client disconnect", func(t *testing.T) {
+		c := h.MustConnect(t)
+		c.Close()
+		connector.WaitControl(t, protocol.TypeCloseSession, c.SessionID)
+	})
+
+	t.Run("connector disconnect", func(t *testing.T) {
+		c := h.MustConnect(t)
+		connector.Stop()
+		c.WaitControl(t, protocol.TypeCloseSession)
+
+		_, err := h.Connect(nil)
+		var connectErr *ConnectError
+		if !errors.As(err, &connectErr) || connectErr.Code != "CONNECTOR_NOT_FOUND" {
+			t.Fatalf("connect without connector: %v, want CONNECTOR_NOT_FOUND", err)
+		}
+	})
+}
+
+func TestRelayReconnect(t *testing.T) {
+	h := Start(t, Options{})
+	c := h.MustConnect(t)
+
+	h.DropRelayConnections()
+	c.WaitClosed(t)
+
+	// The connector re-registers on its own; WaitReady fails the test if it
+	// does not within the harness timeout.
+	h.WaitReady()
+	c2 := h.MustConnect(t)
+	c2.Send(t, userMessage("m1", "back again"))
+	content, end := c2.Reply(t)
+	if end.Type != protocol.EventEnd || content != "back again " {
+		t.Fatalf("reply = %q %+v", content, end)
+	}
+}
@@ -0,0 +1,485 @@
+// Package e2e runs the relay, a connector wired to the mock gateway and
+// protocol clients in one process on loopback ports, for end-to-end tests.
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"openclaw-bridge/connector/pkg/config"
+	"openclaw-bridge/connector/pkg/connector"
+	"openclaw-bridge/connector/pkg/mockgateway"
+	"openclaw-bridge/relay/pkg/server"
+	"openclaw-bridge/shared/protocol"
+)
+
+// Timeout bounds every wait in the harness.
+const Timeout = 10 * time.Second
+
+type Options struct {
+	// Relay configures the relay server.
+	Relay server.Options
+	// Gateway configures the mock gateway behind the connector.
+	Gateway mockgateway.Options
+	// Logger receives relay, connector and gateway logs. Nil discards them.
+	Logger *log.Logger
+}
+
+// Harness is a running relay, mock gateway and connector. Everything is
+// stopped when the test ends.
+type Harness struct {
+	t          testing.TB
+	logger     *log.Logger
+	AccessCode string
+	Gateway    *mockgateway.Server
+
+	Relay *server.Server
+
+	relay      *httptest.Server
+	relayConns *trackingListener
+	gateway    *httptest.Server
+	connector  *Connector
+}
+
+// Start brings up the relay, the mock gateway and one connector, and waits
+// until clients can connect.
+func Start(t testing.TB, opts Options) *Harness {
+	t.Helper()
+	logger := opts.Logger
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+	h := &Harness{t: t, logger: logger, AccessCode: "A-e2e"}
+
+	h.Relay = server.New(logger, opts.Relay)
+	h.relay = httptest.NewUnstartedServer(h.Relay.Handler())
+	h.relayConns = &trackingListener{Listener: h.relay.Listener}
+	h.relay.Listener = h.Relay.Listener(h.relayConns)
+	h.relay.Start()
+	t.Cleanup(h.relay.Close)
+
+	if opts.Gateway.Logger == nil {
+		opts.Gateway.Logger = logger
+	}
+	h.Gateway = mockgateway.New(opts.Gateway)
+	h.gateway = httptest.NewServer(h.Gateway)
+	t.Cleanup(h.gateway.Close)
+
+	h.connector = h.StartConnector()
+	h.WaitReady()
+	return h
+}
+
+// ClientURL is the relay endpoint for clients.
+func (h *Harness) ClientURL() string {
+	return "ws" + strings.TrimPrefix(h.relay.URL, "http") + "/client"
+}
+
+// TunnelURL is the relay endpoint for connectors.
+func (h *Harness) TunnelURL() string {
+	return "ws" + strings.TrimPrefix(h.relay.URL, "http") + "/tunnel"
+}
+
+// Connector returns the connector started by Start.
+func (h *Harness) Connector() *Connector {
+	return h.connector
+}
+
+// DropRelayConnections severs every connection to the relay, as a network
+// failure would, without stopping the relay itself.
+func (h *Harness) DropRelayConnections() {
+	h.relayConns.closeAll()
+}
+
+// WaitReady waits until a client session can be opened and answered, which
+// means a connector is registered and its gateway is connected.
+func (h *Harness) WaitReady() {
+	h.t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for {
+		c, err := h.Connect(nil)
+		if err == nil {
+			err = c.probe()
+			c.Close()
+			if err == nil {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			h.t.Fatalf("bridge not ready: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Connector is an in-process connector, built like the connector binary.
+type Connector struct {
+	// Controls receives every control message the connector gets from the
+	// relay.
+	Controls chan protocol.ControlMessage
+
+	conn   *connector.Connector
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartConnector runs another connector for the harness access code. It is
+// stopped when the test ends.
+func (h *Harness) StartConnector() *Connector {
+	h.t.Helper()
+	raw, _ := json.Marshal(map[string]any{
+		"relay_url":   h.TunnelURL(),
+		"access_code": h.AccessCode,
+		"gateway": map[string]any{
+			"url":                       "ws" + strings.TrimPrefix(h.gateway.URL, "http"),
+			"reconnect_initial_seconds": 1,
+			"reconnect_max_seconds":     1,
+		},
+	})
+	path := filepath.Join(h.t.TempDir(), "connector.json")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		h.t.Fatal(err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		h.t.Fatal(err)
+	}
+
+	c := &Connector{
+		Controls: make(chan protocol.ControlMessage, 64),
+		done:     make(chan struct{}),
+	}
+
+	conn, err := connector.New(cfg, h.logger, connector.Options{
+		OnControl: func(msg protocol.ControlMessage) {
+			select {
+			case c.Controls <- msg:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		h.t.Fatal(err)
+	}
+	c.conn = conn
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go func() {
+		defer close(c.done)
+		_ = conn.Run(ctx)
+	}()
+	h.t.Cleanup(c.Stop)
+	return c
+}
+
+// Stop shuts the connector down and waits for it to exit.
+func (c *Connector) Stop() {
+	c.cancel()
+	<-c.done
+}
+
+// DroppedEvents reports the gateway events the connector dropped.
+func (c *Connector) DroppedEvents() int64 {
+	return c.conn.DroppedEvents()
+}
+
+// WaitControl returns the next control message of type msgType received by
+// the connector for sessionID, skipping others.
+func (c *Connector) WaitControl(t testing.TB, msgType, sessionID string) protocol.ControlMessage {
+	t.Helper()
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case msg := <-c.Controls:
+			if msg.Type == msgType && msg.SessionID == sessionID {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("connector: no %s for session %s", msgType, sessionID)
+			return protocol.ControlMessage{}
+		}
+	}
+}
+
+// Client is a protocol client with one relay session.
+type Client struct {
+	SessionID string
+
+	conn     *websocket.Conn
+	writeMu  sync.Mutex
+	events   chan protocol.Event
+	controls chan protocol.ControlMessage
+	done     chan struct{}
+}
+
+// Connect opens a session. A relay ERROR reply is returned as a
+// *ConnectError.
+func (h *Harness) Connect(caps *protocol.Caps) (*Client, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(h.ClientURL(), nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:     conn,
+		events:   make(chan protocol.Event, 256),
+		controls: make(chan protocol.ControlMessage, 16),
+		done:     make(chan struct{}),
+	}
+	if err := c.writeControl(protocol.ControlMessage{Type: protocol.TypeConnect, AccessCode: h.AccessCode, Caps: caps}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(Timeout))
+	for c.SessionID == "" {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		msg, err := protocol.DecodeControl(data)
+		if err != nil {
+			continue
+		}
+		switch msg.Type {
+		case protocol.TypeConnectOK:
+			c.SessionID = msg.SessionID
+		case protocol.TypeError:
+			_ = conn.Close()
+			return nil, &ConnectError{Code: msg.Code, Message: msg.Message}
+		}
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	go c.readLoop()
+	return c, nil
+}
+
+// MustConnect is Connect that fails the test on error.
+func (h *Harness) MustConnect(t testing.TB) *Client {
+	t.Helper()
+	c, err := h.Connect(nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+// ConnectError is a relay ERROR received while connecting.
+type ConnectError struct {
+	Code    string
+	Message string
+}
+
+func (e *ConnectError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+func (c *Client) readLoop() {
+	defer close(c.done)
+	for {
+		msgType, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if msgType == websocket.TextMessage {
+			// Tests only wait for the odd control message; dropping
+			// unread ones keeps events flowing.
+			if msg, err := protocol.DecodeControl(data); err == nil {
+				select {
+				case c.controls <- msg:
+				default:
+				}
+			}
+			continue
+		}
+		sid, _, payload, err := protocol.ParseDataFrame(data)
+		if err != nil || sid != c.SessionID {
+			continue
+		}
+		if event, err := protocol.DecodeEvent(payload); err == nil {
+			c.events <- event
+		}
+	}
+}
+
+// Send writes event to the session.
+func (c *Client) Send(t testing.TB, event protocol.Event) {
+	t.Helper()
+	payload, err := protocol.EncodeEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendData(t, 0, payload)
+}
+
+// SendChunk writes one attachment chunk to the session.
+func (c *Client) SendChunk(t testing.TB, chunk protocol.AttachmentChunk) {
+	t.Helper()
+	payload, err := protocol.EncodeAttachmentChunk(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sendData(t, protocol.FlagAttachment, payload)
+}
+
+func (c *Client) sendData(t testing.TB, flags byte, payload []byte) {
+	t.Helper()
+	frame, err := protocol.BuildDataFrame(c.SessionID, flags, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.WriteMessage(websocket.BinaryMessage, frame); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+}
+
+// SendControl writes a control message on the client connection.
+func (c *Client) SendControl(t testing.TB, msg protocol.ControlMessage) {
+	t.Helper()
+	if err := c.writeControl(msg); err != nil {
+		t.Fatalf("send control: %v", err)
+	}
+}
+
+func (c *Client) writeControl(msg protocol.ControlMessage) error {
+	data, err := protocol.EncodeControl(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Next returns the next event of the session.
+func (c *Client) Next(t testing.TB) protocol.Event {
+	t.Helper()
+	select {
+	case event := <-c.events:
+		return event
+	case <-c.done:
+		t.Fatal("client connection closed")
+	case <-time.After(Timeout):
+		t.Fatal("no event")
+	}
+	return protocol.Event{}
+}
+
+// Reply collects tokens until the end or error event of the current run.
+func (c *Client) Reply(t testing.TB) (string, protocol.Event) {
+	t.Helper()
+	var content strings.Builder
+	for {
+		event := c.Next(t)
+		switch event.Type {
+		case protocol.EventToken:
+			content.WriteString(event.Content)
+		case protocol.EventEnd, protocol.EventError:
+			return content.String(), event
+		}
+	}
+}
+
+// WaitControl returns the next control message of type msgType, skipping
+// others.
+func (c *Client) WaitControl(t testing.TB, msgType string) protocol.ControlMessage {
+	t.Helper()
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case msg := <-c.controls:
+			if msg.Type == msgType {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("client: no %s", msgType)
+			return protocol.ControlMessage{}
+		}
+	}
+}
+
+// WaitClosed waits until the relay closes the client connection.
+func (c *Client) WaitClosed(t testing.TB) {
+	t.Helper()
+	select {
+	case <-c.done:
+	case <-time.After(Timeout):
+		t.Fatal("client connection still open")
+	}
+}
+
+// Close drops the client connection without closing the session first.
+func (c *Client) Close() {
+	_ = c.conn.Close()
+}
+
+// probe sends one message and checks that it is answered.
+func (c *Client) probe() error {
+	payload, _ := protocol.EncodeEvent(protocol.Event{Type: protocol.EventUserMessage, ID: "probe", Content: "ping"})
+	frame, _ := protocol.BuildDataFrame(c.SessionID, 0, payload)
+	c.writeMu.Lock()
+	err := c.conn.WriteMessage(websocket.BinaryMessage, frame)
+	c.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	timeout := time.After(Timeout)
+	for {
+		select {
+		case event := <-c.events:
+			switch event.Type {
+			case protocol.EventEnd:
+				return nil
+			case protocol.EventError:
+				return fmt.Errorf("%s: %s", event.Code, event.Message)
+			}
+		case <-c.done:
+			return errors.New("connection closed")
+		case <-timeout:
+			return errors.New("no reply")
+		}
+	}
+}
+
+// trackingListener remembers accepted connections so they can be severed.
+type trackingListener struct {
+	net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *trackingListener) closeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+	l.conns = nil
+}
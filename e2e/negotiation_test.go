@@ -0,0 +1,104 @@
+package e2e
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"openclaw-bridge/client"
+	"openclaw-bridge/relay/pkg/server"
+	"openclaw-bridge/shared/protocol"
+)
+
+// handshake sends raw as the first message on url and returns the relay's
+// first control reply.
+func handshake(t *testing.T, url, raw string) protocol.ControlMessage {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(raw)); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(Timeout))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read reply to %s: %v", raw, err)
+	}
+	msg, err := protocol.DecodeControl(data)
+	if err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+	return msg
+}
+
+func TestNegotiatedCaps(t *testing.T) {
+	h := Start(t, Options{Relay: server.Options{MaxFrameSize: 64 << 10}})
+	sess := dial(t, h, client.Options{Caps: &protocol.Caps{Events: []string{protocol.EventReasoning}, MaxFrameSize: 1 << 20}})
+
+	if sess.Version() != protocol.Version {
+		t.Errorf("version = %d, want %d", sess.Version(), protocol.Version)
+	}
+	want := protocol.Caps{Events: []string{protocol.EventReasoning}, MaxFrameSize: 64 << 10, Attachments: true, Compression: protocol.SupportedCompression}
+	if got := sess.Caps(); !reflect.DeepEqual(got, want) {
+		t.Errorf("client caps = %+v, want %+v", got, want)
+	}
+	open := h.Connector().WaitControl(t, protocol.TypeSessionOpen, sess.ID())
+	if open.V != protocol.Version || open.Caps == nil || !reflect.DeepEqual(*open.Caps, want) {
+		t.Errorf("SESSION_OPEN v=%d caps=%+v, want v=%d caps=%+v", open.V, open.Caps, protocol.Version, want)
+	}
+
+	err := sess.Send(userMessage("big", strings.Repeat("x", 64<<10)))
+	if !errors.Is(err, client.ErrFrameTooLarge) {
+		t.Errorf("oversized send: err = %v, want ErrFrameTooLarge", err)
+	}
+	if err := sess.Send(userMessage("m1", "still fine")); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if _, end := reply(t, sess, "m1"); end.Type != protocol.EventEnd {
+		t.Fatalf("terminal event = %+v, want end", end)
+	}
+}
+
+func TestHandshakeVersions(t *testing.T) {
+	h := Start(t, Options{})
+	code := `"access_code":"` + h.AccessCode + `"`
+
+	cases := []struct {
+		name, url, raw string
+		wantType       string
+		wantCode       string
+	}{
+		{"client with newer versions too", h.ClientURL(), `{"type":"CONNECT","v":1,"versions":[1,7],` + code + `}`, protocol.TypeConnectOK, ""},
+		{"client without version", h.ClientURL(), `{"type":"CONNECT",` + code + `}`, protocol.TypeError, "BAD_CONTROL"},
+		{"client with unsupported version", h.ClientURL(), `{"type":"CONNECT","v":7,"versions":[7],` + code + `}`, protocol.TypeError, "UNSUPPORTED_VERSION"},
+		{"connector with unsupported version", h.TunnelURL(), `{"type":"REGISTER","v":7,"versions":[7],"access_code_hash":"sha256:00"}`, protocol.TypeError, "UNSUPPORTED_VERSION"},
+	}
+	for _, c := range cases {
+		msg := handshake(t, c.url, c.raw)
+		if msg.Type != c.wantType || msg.Code != c.wantCode {
+			t.Errorf("%s: reply %s %s %q, want %s %s", c.name, msg.Type, msg.Code, msg.Message, c.wantType, c.wantCode)
+		}
+		if msg.Type == protocol.TypeConnectOK && msg.V != protocol.Version {
+			t.Errorf("%s: CONNECT_OK v=%d, want %d", c.name, msg.V, protocol.Version)
+		}
+	}
+
+	// A client that predates negotiation sends no version list; it keeps
+	// receiving attachments as before.
+	// Its top-level e2ee is a request, reported active only if the
+	// connector supports it too.
+	msg := handshake(t, h.ClientURL(), `{"type":"CONNECT","v":1,"e2ee":true,`+code+`}`)
+	if msg.Type != protocol.TypeConnectOK || msg.Caps == nil || !msg.Caps.Attachments || msg.Caps.E2EE {
+		t.Fatalf("legacy client: reply %+v caps %+v, want CONNECT_OK with attachments and no e2ee", msg, msg.Caps)
+	}
+	if open := h.Connector().WaitControl(t, protocol.TypeSessionOpen, msg.SessionID); open.E2EE || open.Caps == nil || open.Caps.E2EE {
+		t.Errorf("legacy client: SESSION_OPEN e2ee=%t caps %+v, want e2ee off", open.E2EE, open.Caps)
+	}
+}
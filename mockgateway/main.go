@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"openclaw-bridge/connector/pkg/mockgateway"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:18789", "listen address")
+	token := flag.String("token", "", "gateway auth token clients must send (empty accepts any)")
+	shape := flag.String("shape", mockgateway.ShapeChat, "reply event shape: chat or agent")
+	scriptPath := flag.String("script", "", "file whose lines are streamed as the reply to every message (default echoes the message)")
+	authFail := flag.Bool("auth-fail", false, "reject every connect as unauthorized")
+	tokenDelay := flag.Duration("token-delay", 50*time.Millisecond, "pause before each streamed chunk")
+	disconnectAfter := flag.Int("disconnect-after", 0, "close the connection after this many chunks of a run (0 disables)")
+	malformed := flag.Bool("malformed", false, "send malformed frames and payloads between chunks")
+	runError := flag.Bool("run-error", false, "finish every run with an error event")
+	dropFinal := flag.Bool("drop-final", false, "never send the terminal event of a run")
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "[mockgateway] ", log.LstdFlags|log.Lmicroseconds)
+
+	if *shape != mockgateway.ShapeChat && *shape != mockgateway.ShapeAgent {
+		logger.Fatalf("-shape must be %s or %s", mockgateway.ShapeChat, mockgateway.ShapeAgent)
+	}
+	var script []string
+	if *scriptPath != "" {
+		raw, err := os.ReadFile(*scriptPath)
+		if err != nil {
+			logger.Fatalf("read script error=%v", err)
+		}
+		for _, line := range strings.SplitAfter(string(raw), "\n") {
+			if line != "" {
+				script = append(script, line)
+			}
+		}
+	}
+
+	server := mockgateway.New(mockgateway.Options{
+		Token:  *token,
+		Shape:  *shape,
+		Script: script,
+		Faults: mockgateway.Faults{
+			AuthFail:        *authFail,
+			TokenDelay:      *tokenDelay,
+			DisconnectAfter: *disconnectAfter,
+			Malformed:       *malformed,
+			RunError:        *runError,
+			DropFinal:       *dropFinal,
+		},
+		Logger: logger,
+	})
+
+	logger.Printf("listening addr=%s shape=%s", *addr, *shape)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		logger.Fatalf("server exited error=%v", err)
+	}
+}
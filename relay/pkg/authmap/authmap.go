@@ -10,6 +10,7 @@ import (
 type Entry struct {
 	Peer       *hub.Peer
 	Generation int
+	Versions   []int
 	Caps       protocol.Caps
 }
 
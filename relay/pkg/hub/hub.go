@@ -1,7 +1,9 @@
 package hub
 
 import (
+	"errors"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
@@ -13,28 +15,175 @@ const (
 	RoleClient    Role = "client"
 )
 
+const (
+	// DefaultQueueBytes is how many bytes a peer may have waiting to be
+	// written unless PeerOptions say otherwise.
+	DefaultQueueBytes = 16 << 20
+	// DefaultWriteTimeout bounds a single write unless PeerOptions say
+	// otherwise.
+	DefaultWriteTimeout = 10 * time.Second
+	// controlHeadroom lets control messages such as CLOSE_SESSION through
+	// after DATA frames have filled the queue.
+	controlHeadroom = 64 << 10
+)
+
+// ErrQueueFull is returned by SendBinary when the message does not fit in
+// the QueueBytes left for the peer. The peer stays connected.
+var ErrQueueFull = errors.New("hub: peer write queue full")
+
+// ErrPeerClosed is returned for messages sent to a closed peer, including
+// a peer disconnected because even control messages no longer fit.
+var ErrPeerClosed = errors.New("hub: peer closed")
+
+// PeerOptions bound the outbound queue of a peer.
+type PeerOptions struct {
+	// QueueBytes is how many bytes of messages may wait to be written. A
+	// message larger than that is still accepted into an empty queue. 0
+	// selects DefaultQueueBytes.
+	QueueBytes int
+	// WriteTimeout bounds each write; a peer that does not keep up is
+	// disconnected. 0 selects DefaultWriteTimeout.
+	WriteTimeout time.Duration
+	// OnWrite, if set, is called with the size of every message once it
+	// has been written. Messages dropped by Disconnect are never reported.
+	OnWrite func(n int)
+}
+
+type outbound struct {
+	msgType  int
+	data     []byte
+	compress bool
+}
+
+// Peer is a relay connection. Messages are queued and written by a
+// goroutine of their own, so a slow peer never blocks its senders.
 type Peer struct {
 	ID   string
 	Role Role
 	Conn *websocket.Conn
 
-	writeMu sync.Mutex
+	opts PeerOptions
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []outbound
+	queued int // bytes in queue
+	closed bool
+	done   chan struct{}
 }
 
-func NewPeer(id string, role Role, conn *websocket.Conn) *Peer {
-	return &Peer{ID: id, Role: role, Conn: conn}
+// NewPeer starts the writer of conn. Close the peer to stop it.
+func NewPeer(id string, role Role, conn *websocket.Conn, opts PeerOptions) *Peer {
+	if opts.QueueBytes <= 0 {
+		opts.QueueBytes = DefaultQueueBytes
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = DefaultWriteTimeout
+	}
+	p := &Peer{ID: id, Role: role, Conn: conn, opts: opts, done: make(chan struct{})}
+	p.cond = sync.NewCond(&p.mu)
+	go p.writeLoop()
+	return p
 }
 
+// SendText queues a control message. If the queue is full even with the
+// headroom reserved for control messages, the peer is disconnected.
 func (p *Peer) SendText(data []byte) error {
-	p.writeMu.Lock()
-	defer p.writeMu.Unlock()
-	return p.Conn.WriteMessage(websocket.TextMessage, data)
+	return p.enqueue(outbound{msgType: websocket.TextMessage, data: data, compress: true}, p.opts.QueueBytes+controlHeadroom)
 }
 
-func (p *Peer) SendBinary(data []byte) error {
-	p.writeMu.Lock()
-	defer p.writeMu.Unlock()
-	return p.Conn.WriteMessage(websocket.BinaryMessage, data)
+// SendBinary queues a binary message. compress selects permessage-deflate
+// for it if the connection negotiated the extension. It returns
+// ErrQueueFull without queueing when the peer is too far behind.
+func (p *Peer) SendBinary(data []byte, compress bool) error {
+	return p.enqueue(outbound{msgType: websocket.BinaryMessage, data: data, compress: compress}, p.opts.QueueBytes)
+}
+
+func (p *Peer) enqueue(msg outbound, limit int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrPeerClosed
+	}
+	if len(p.queue) > 0 && p.queued+len(msg.data) > limit {
+		if msg.msgType == websocket.TextMessage {
+			p.abortLocked()
+			return ErrPeerClosed
+		}
+		return ErrQueueFull
+	}
+	p.queue = append(p.queue, msg)
+	p.queued += len(msg.data)
+	p.cond.Signal()
+	return nil
+}
+
+// Queued returns the number of bytes waiting to be written.
+func (p *Peer) Queued() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.queued
+}
+
+// Close stops accepting messages and closes the connection once the
+// queued ones are written. It does not wait; see Done.
+func (p *Peer) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.closed {
+		p.closed = true
+		p.cond.Signal()
+	}
+}
+
+// Disconnect drops the queued messages and closes the connection now.
+func (p *Peer) Disconnect() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.abortLocked()
+}
+
+func (p *Peer) abortLocked() {
+	p.closed = true
+	p.queue = nil
+	p.queued = 0
+	p.cond.Signal()
+	_ = p.Conn.Close()
+}
+
+// Done is closed when the writer has exited and the connection is closed.
+func (p *Peer) Done() <-chan struct{} {
+	return p.done
+}
+
+func (p *Peer) writeLoop() {
+	defer close(p.done)
+	defer p.Conn.Close()
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		msg := p.queue[0]
+		p.queue[0] = outbound{}
+		p.queue = p.queue[1:]
+		p.queued -= len(msg.data)
+		p.mu.Unlock()
+
+		_ = p.Conn.SetWriteDeadline(time.Now().Add(p.opts.WriteTimeout))
+		p.Conn.EnableWriteCompression(msg.compress)
+		if err := p.Conn.WriteMessage(msg.msgType, msg.data); err != nil {
+			p.Disconnect()
+			return
+		}
+		if p.opts.OnWrite != nil {
+			p.opts.OnWrite(len(msg.data))
+		}
+	}
 }
 
 type Manager struct {
@@ -2,9 +2,19 @@ package metrics
 
 import "sync/atomic"
 
+// Collector counts relay traffic. Logical bytes are WebSocket messages as
+// the relay reads and writes them; wire bytes are what crossed the network
+// for them: after permessage-deflate, with WebSocket framing and the upgrade
+// handshake.
 type Collector struct {
-	forwardedBytes atomic.Int64
-	errors         atomic.Int64
+	forwardedBytes   atomic.Int64
+	compressedFrames atomic.Int64
+	logicalIn        atomic.Int64
+	logicalOut       atomic.Int64
+	wireIn           atomic.Int64
+	wireOut          atomic.Int64
+	slowPeers        atomic.Int64
+	errors           atomic.Int64
 }
 
 func New() *Collector {
@@ -15,18 +25,50 @@ func (c *Collector) AddForwardedBytes(n int) {
 	c.forwardedBytes.Add(int64(n))
 }
 
+// IncCompressedFrames counts a forwarded DATA frame with a compressed
+// payload.
+func (c *Collector) IncCompressedFrames() {
+	c.compressedFrames.Add(1)
+}
+
+// AddLogicalIn and AddLogicalOut count WebSocket message bytes.
+func (c *Collector) AddLogicalIn(n int) {
+	c.logicalIn.Add(int64(n))
+}
+
+func (c *Collector) AddLogicalOut(n int) {
+	c.logicalOut.Add(int64(n))
+}
+
+// IncSlowPeer counts a peer dropped for a full write queue.
+func (c *Collector) IncSlowPeer() {
+	c.slowPeers.Add(1)
+}
+
 func (c *Collector) IncError() {
 	c.errors.Add(1)
 }
 
 type Snapshot struct {
-	ForwardedBytes int64
-	Errors         int64
+	ForwardedBytes   int64 `json:"forwarded_bytes"`
+	CompressedFrames int64 `json:"compressed_frames"`
+	LogicalBytesIn   int64 `json:"logical_bytes_in"`
+	LogicalBytesOut  int64 `json:"logical_bytes_out"`
+	WireBytesIn      int64 `json:"wire_bytes_in"`
+	WireBytesOut     int64 `json:"wire_bytes_out"`
+	SlowPeers        int64 `json:"slow_peers"`
+	Errors           int64 `json:"errors"`
 }
 
 func (c *Collector) Snapshot() Snapshot {
 	return Snapshot{
-		ForwardedBytes: c.forwardedBytes.Load(),
-		Errors:         c.errors.Load(),
+		ForwardedBytes:   c.forwardedBytes.Load(),
+		CompressedFrames: c.compressedFrames.Load(),
+		LogicalBytesIn:   c.logicalIn.Load(),
+		LogicalBytesOut:  c.logicalOut.Load(),
+		WireBytesIn:      c.wireIn.Load(),
+		WireBytesOut:     c.wireOut.Load(),
+		SlowPeers:        c.slowPeers.Load(),
+		Errors:           c.errors.Load(),
 	}
 }
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// Listener wraps l so that the bytes of its connections can be counted as
+// wire bytes. Connections are only counted once TrackWire is called for
+// them, so plain HTTP requests such as /healthz are left out.
+func (c *Collector) Listener(l net.Listener) net.Listener {
+	return &wireListener{Listener: l}
+}
+
+// TrackWire starts counting conn, which must come from a Listener, as wire
+// bytes, including the bytes it has carried so far. Other connections are
+// ignored.
+func (c *Collector) TrackWire(conn net.Conn) {
+	wc, ok := conn.(*wireConn)
+	if !ok {
+		return
+	}
+	wc.sink.Store(c)
+	c.wireIn.Add(wc.in.Swap(0))
+	c.wireOut.Add(wc.out.Swap(0))
+}
+
+type wireListener struct {
+	net.Listener
+}
+
+func (l *wireListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &wireConn{Conn: conn}, nil
+}
+
+// wireConn counts bytes locally until TrackWire hands it a collector.
+type wireConn struct {
+	net.Conn
+	sink    atomic.Pointer[Collector]
+	in, out atomic.Int64
+}
+
+func (c *wireConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if sink := c.sink.Load(); sink != nil {
+		sink.wireIn.Add(int64(n))
+	} else {
+		c.in.Add(int64(n))
+	}
+	return n, err
+}
+
+func (c *wireConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if sink := c.sink.Load(); sink != nil {
+		sink.wireOut.Add(int64(n))
+	} else {
+		c.out.Add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,502 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"openclaw-bridge/relay/pkg/authmap"
+	"openclaw-bridge/relay/pkg/hub"
+	"openclaw-bridge/relay/pkg/metrics"
+	"openclaw-bridge/relay/pkg/ratelimit"
+	"openclaw-bridge/relay/pkg/sessions"
+	"openclaw-bridge/shared/protocol"
+	"openclaw-bridge/web/sdk"
+)
+
+// DefaultMaxFrameSize is the largest WebSocket message the relay accepts
+// unless Options say otherwise.
+const DefaultMaxFrameSize = 32 << 20
+
+type Options struct {
+	// MaxFrameSize caps every WebSocket message in bytes and is advertised
+	// to peers as max_frame_size. 0 selects DefaultMaxFrameSize; a negative
+	// value disables the limit.
+	MaxFrameSize int
+	// QueueBytes bounds the bytes of DATA frames waiting to be written to
+	// one peer. 0 selects hub.DefaultQueueBytes.
+	QueueBytes int
+	// WriteTimeout bounds each write to a peer. 0 selects
+	// hub.DefaultWriteTimeout.
+	WriteTimeout time.Duration
+}
+
+// Server routes control messages and DATA frames between clients and
+// connectors.
+type Server struct {
+	logger       *log.Logger
+	maxFrameSize int
+	peerOpts     hub.PeerOptions
+
+	upgrader websocket.Upgrader
+
+	hub       *hub.Manager
+	auth      *authmap.Store
+	sessions  *sessions.Store
+	ratelimit *ratelimit.Limiter
+	metrics   *metrics.Collector
+}
+
+func New(logger *log.Logger, opts Options) *Server {
+	switch {
+	case opts.MaxFrameSize == 0:
+		opts.MaxFrameSize = DefaultMaxFrameSize
+	case opts.MaxFrameSize < 0:
+		opts.MaxFrameSize = 0
+	}
+	collector := metrics.New()
+	return &Server{
+		logger:       logger,
+		maxFrameSize: opts.MaxFrameSize,
+		peerOpts: hub.PeerOptions{
+			QueueBytes:   opts.QueueBytes,
+			WriteTimeout: opts.WriteTimeout,
+			OnWrite:      collector.AddLogicalOut,
+		},
+		upgrader: websocket.Upgrader{
+			CheckOrigin:       func(_ *http.Request) bool { return true },
+			EnableCompression: true,
+		},
+		hub:       hub.NewManager(),
+		auth:      authmap.NewStore(),
+		sessions:  sessions.NewStore(),
+		ratelimit: ratelimit.New(),
+		metrics:   collector,
+	}
+}
+
+func (s *Server) sendControl(peer *hub.Peer, msg protocol.ControlMessage) error {
+	data, err := protocol.EncodeControl(msg)
+	if err != nil {
+		return err
+	}
+	return peer.SendText(data)
+}
+
+func (s *Server) sendError(peer *hub.Peer, code, message string) {
+	err := s.sendControl(peer, protocol.ControlMessage{
+		Type:    protocol.TypeError,
+		Code:    code,
+		Message: message,
+	})
+	if err != nil {
+		s.logger.Printf("error send error-msg peer=%s err=%v", peer.ID, err)
+		s.metrics.IncError()
+	}
+}
+
+func (s *Server) routeBinary(sender *hub.Peer, frame []byte) {
+	sessionID, flags, _, err := protocol.ParseDataFrame(frame)
+	if err != nil {
+		s.metrics.IncError()
+		s.sendError(sender, "BAD_DATA_FRAME", "invalid data frame")
+		return
+	}
+
+	session, ok := s.sessions.Get(sessionID)
+	if !ok {
+		s.metrics.IncError()
+		s.sendError(sender, "SESSION_NOT_FOUND", "session not found")
+		return
+	}
+
+	var target *hub.Peer
+	switch sender {
+	case session.Client:
+		target = session.Connector
+	case session.Connector:
+		target = session.Client
+	default:
+		s.metrics.IncError()
+		s.sendError(sender, "SESSION_PEER_MISMATCH", "session peer mismatch")
+		return
+	}
+
+	// Compressed and encrypted payloads gain nothing from permessage-deflate.
+	if err := target.SendBinary(frame, protocol.WireCompressible(flags)); err != nil {
+		s.metrics.IncError()
+		s.logger.Printf("error forward sid=%s bytes=%d err=%v", sessionID, len(frame), err)
+		if errors.Is(err, hub.ErrQueueFull) {
+			s.dropSlowPeer(session, target)
+			return
+		}
+		s.closeSession(sessionID)
+		return
+	}
+
+	s.metrics.AddForwardedBytes(len(frame))
+	if flags&protocol.FlagCompressed != 0 {
+		s.metrics.IncCompressedFrames()
+	}
+	s.logger.Printf("forward sid=%s bytes=%d", sessionID, len(frame))
+}
+
+// dropSlowPeer handles a peer whose write queue is full. A client has only
+// this session and is disconnected, which closes the session. A connector
+// serves other sessions too, so only this one is closed.
+func (s *Server) dropSlowPeer(session *sessions.Session, target *hub.Peer) {
+	s.metrics.IncSlowPeer()
+	s.logger.Printf("slow peer peer=%s role=%s sid=%s queued=%d", target.ID, target.Role, session.ID, target.Queued())
+	if target.Role == hub.RoleClient {
+		target.Disconnect()
+		return
+	}
+	s.sendError(session.Client, "SLOW_PEER", "connector is not keeping up; session closed")
+	s.closeSession(session.ID)
+}
+
+func (s *Server) closeSession(sessionID string) {
+	session, ok := s.sessions.Delete(sessionID)
+	if !ok {
+		return
+	}
+
+	closeMsg := protocol.ControlMessage{
+		Type:      protocol.TypeCloseSession,
+		SessionID: sessionID,
+	}
+
+	_ = s.sendControl(session.Client, closeMsg)
+	_ = s.sendControl(session.Connector, closeMsg)
+	s.logger.Printf("session closed sid=%s", sessionID)
+}
+
+func (s *Server) cleanupPeer(peer *hub.Peer) {
+	removedHashes := s.auth.DeleteByPeer(peer)
+	for _, hash := range removedHashes {
+		s.logger.Printf("connector removed hash=%s", hash)
+	}
+
+	removedSessions := s.sessions.DeleteByPeer(peer)
+	for _, session := range removedSessions {
+		other := session.Client
+		if other == peer {
+			other = session.Connector
+		}
+		if other != nil {
+			_ = s.sendControl(other, protocol.ControlMessage{
+				Type:      protocol.TypeCloseSession,
+				SessionID: session.ID,
+			})
+		}
+		s.logger.Printf("session removed sid=%s reason=peer_disconnect", session.ID)
+	}
+
+	s.hub.Remove(peer.ID)
+	peer.Close()
+}
+
+func (s *Server) connectorLoop(peer *hub.Peer) {
+	defer s.cleanupPeer(peer)
+
+	for {
+		msgType, data, err := peer.Conn.ReadMessage()
+		if err != nil {
+			s.logger.Printf("connector disconnect peer=%s err=%v", peer.ID, err)
+			return
+		}
+		s.metrics.AddLogicalIn(len(data))
+
+		switch msgType {
+		case websocket.TextMessage:
+			msg, err := protocol.DecodeControl(data)
+			if err != nil {
+				s.metrics.IncError()
+				code, message := controlError(err)
+				s.sendError(peer, code, message)
+				continue
+			}
+			s.handleControl(peer, msg)
+		case websocket.BinaryMessage:
+			s.routeBinary(peer, data)
+		}
+	}
+}
+
+func (s *Server) clientLoop(peer *hub.Peer) {
+	defer s.cleanupPeer(peer)
+
+	for {
+		msgType, data, err := peer.Conn.ReadMessage()
+		if err != nil {
+			s.logger.Printf("client disconnect peer=%s err=%v", peer.ID, err)
+			return
+		}
+		s.metrics.AddLogicalIn(len(data))
+
+		switch msgType {
+		case websocket.TextMessage:
+			msg, err := protocol.DecodeControl(data)
+			if err != nil {
+				s.metrics.IncError()
+				code, message := controlError(err)
+				s.sendError(peer, code, message)
+				continue
+			}
+			s.handleControl(peer, msg)
+		case websocket.BinaryMessage:
+			s.routeBinary(peer, data)
+		}
+	}
+}
+
+// controlError maps a DecodeControl error to an ERROR code and message.
+func controlError(err error) (code, message string) {
+	var versionErr *protocol.VersionError
+	switch {
+	case errors.As(err, &versionErr):
+		return "UNSUPPORTED_VERSION", fmt.Sprintf("relay supports protocol versions %v, got %v", versionErr.Supported, versionErr.Offered)
+	case errors.Is(err, protocol.ErrMissingVersion):
+		return "BAD_CONTROL", "invalid control message: missing protocol version"
+	default:
+		return "BAD_CONTROL", "invalid control message"
+	}
+}
+
+// readHandshake reads the first message of a new connection, which must be
+// a control message of type want. Anything else is answered with an ERROR
+// and the connection is closed.
+func (s *Server) readHandshake(conn *websocket.Conn, want string) (protocol.ControlMessage, bool) {
+	if s.maxFrameSize > 0 {
+		conn.SetReadLimit(int64(s.maxFrameSize))
+	}
+	s.metrics.TrackWire(conn.NetConn())
+	msgType, data, err := conn.ReadMessage()
+	if err != nil {
+		_ = conn.Close()
+		return protocol.ControlMessage{}, false
+	}
+	s.metrics.AddLogicalIn(len(data))
+	if msgType != websocket.TextMessage {
+		s.rejectHandshake(conn, "BAD_CONTROL", "expected "+want)
+		return protocol.ControlMessage{}, false
+	}
+	msg, err := protocol.DecodeControl(data)
+	if err != nil {
+		code, message := controlError(err)
+		s.rejectHandshake(conn, code, message)
+		return protocol.ControlMessage{}, false
+	}
+	if msg.Type != want {
+		s.rejectHandshake(conn, "BAD_CONTROL", "expected "+want)
+		return protocol.ControlMessage{}, false
+	}
+	return msg, true
+}
+
+// rejectHandshake answers a connection that has no peer yet with an ERROR
+// and closes it.
+func (s *Server) rejectHandshake(conn *websocket.Conn, code, message string) {
+	s.metrics.IncError()
+	s.logger.Printf("handshake rejected code=%s message=%q", code, message)
+	if data, err := protocol.EncodeControl(protocol.ControlMessage{Type: protocol.TypeError, Code: code, Message: message}); err == nil {
+		if conn.WriteMessage(websocket.TextMessage, data) == nil {
+			s.metrics.AddLogicalOut(len(data))
+		}
+	}
+	_ = conn.Close()
+}
+
+func (s *Server) handleControl(peer *hub.Peer, msg protocol.ControlMessage) {
+	if msg.Type == protocol.TypeHeartbeat {
+		return
+	}
+	if msg.Type == protocol.TypeCloseSession && msg.SessionID != "" {
+		s.closeSession(msg.SessionID)
+		return
+	}
+	s.sendError(peer, "UNSUPPORTED_CONTROL", "unsupported control message in this state")
+}
+
+func (s *Server) handleTunnel(w http.ResponseWriter, r *http.Request) {
+	if !s.ratelimit.Allow(r.RemoteAddr) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.metrics.IncError()
+		s.logger.Printf("upgrade tunnel error=%v", err)
+		return
+	}
+
+	registerMsg, ok := s.readHandshake(conn, protocol.TypeRegister)
+	if !ok {
+		return
+	}
+	if registerMsg.AccessCodeHash == "" {
+		s.rejectHandshake(conn, "BAD_CONTROL", "missing access_code_hash")
+		return
+	}
+	if _, ok := protocol.NegotiateVersion(registerMsg.OfferedVersions()); !ok {
+		s.rejectHandshake(conn, "UNSUPPORTED_VERSION", fmt.Sprintf("relay supports protocol versions %v, connector offers %v", protocol.SupportedVersions, registerMsg.OfferedVersions()))
+		return
+	}
+
+	peer := hub.NewPeer(newID("c_"), hub.RoleConnector, conn, s.peerOpts)
+	s.hub.Add(peer)
+
+	caps := protocol.LegacyCaps(registerMsg.Caps)
+	if len(registerMsg.Versions) > 0 && registerMsg.Caps != nil {
+		caps = *registerMsg.Caps
+	}
+
+	prev, replaced := s.auth.Set(registerMsg.AccessCodeHash, authmap.Entry{
+		Peer:       peer,
+		Generation: registerMsg.Generation,
+		Versions:   registerMsg.OfferedVersions(),
+		Caps:       caps,
+	})
+	if replaced && prev.Peer != nil && prev.Peer != peer {
+		s.logger.Printf("connector replaced hash=%s old=%s new=%s", registerMsg.AccessCodeHash, prev.Peer.ID, peer.ID)
+		prev.Peer.Disconnect()
+	}
+
+	s.logger.Printf("connector registered peer=%s hash=%s versions=%v", peer.ID, registerMsg.AccessCodeHash, registerMsg.OfferedVersions())
+	s.connectorLoop(peer)
+}
+
+func (s *Server) handleClient(w http.ResponseWriter, r *http.Request) {
+	if !s.ratelimit.Allow(r.RemoteAddr) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.metrics.IncError()
+		s.logger.Printf("upgrade client error=%v", err)
+		return
+	}
+
+	connectMsg, ok := s.readHandshake(conn, protocol.TypeConnect)
+	if !ok {
+		return
+	}
+	if connectMsg.AccessCode == "" {
+		s.rejectHandshake(conn, "BAD_CONTROL", "missing access_code")
+		return
+	}
+
+	clientPeer := hub.NewPeer(newID("u_"), hub.RoleClient, conn, s.peerOpts)
+	s.hub.Add(clientPeer)
+
+	hash := protocol.HashAccessCode(connectMsg.AccessCode)
+	connectorEntry, ok := s.auth.Get(hash)
+	if !ok || connectorEntry.Peer == nil {
+		s.sendError(clientPeer, "CONNECTOR_NOT_FOUND", "connector not online")
+		s.cleanupPeer(clientPeer)
+		return
+	}
+
+	version, ok := protocol.NegotiateVersion(connectMsg.OfferedVersions(), connectorEntry.Versions)
+	if !ok {
+		s.sendError(clientPeer, "UNSUPPORTED_VERSION", fmt.Sprintf("no common protocol version: client offers %v, relay supports %v, connector supports %v",
+			connectMsg.OfferedVersions(), protocol.SupportedVersions, connectorEntry.Versions))
+		s.cleanupPeer(clientPeer)
+		return
+	}
+	clientCaps := protocol.LegacyCaps(connectMsg.Caps)
+	// Clients that predate negotiation ask for E2EE with the top-level flag.
+	clientCaps.E2EE = clientCaps.E2EE || connectMsg.E2EE
+	if len(connectMsg.Versions) > 0 && connectMsg.Caps != nil {
+		clientCaps = *connectMsg.Caps
+	}
+	caps := protocol.IntersectCaps(clientCaps, connectorEntry.Caps, s.maxFrameSize)
+
+	sessionID := newID("s_")
+	session := &sessions.Session{
+		ID:        sessionID,
+		Client:    clientPeer,
+		Connector: connectorEntry.Peer,
+		E2EE:      caps.E2EE,
+		Version:   version,
+		Caps:      caps,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.sessions.Set(session)
+
+	if err := s.sendControl(clientPeer, protocol.ControlMessage{
+		Type:      protocol.TypeConnectOK,
+		V:         version,
+		SessionID: sessionID,
+		Caps:      &caps,
+	}); err != nil {
+		s.metrics.IncError()
+		s.closeSession(sessionID)
+		s.cleanupPeer(clientPeer)
+		return
+	}
+
+	if err := s.sendControl(connectorEntry.Peer, protocol.ControlMessage{
+		Type:      protocol.TypeSessionOpen,
+		V:         version,
+		SessionID: sessionID,
+		E2EE:      caps.E2EE,
+		Caps:      &caps,
+	}); err != nil {
+		s.metrics.IncError()
+		s.closeSession(sessionID)
+		s.cleanupPeer(clientPeer)
+		return
+	}
+
+	s.logger.Printf("session open sid=%s client=%s connector=%s v=%d", sessionID, clientPeer.ID, connectorEntry.Peer.ID, version)
+	s.clientLoop(clientPeer)
+}
+
+func newID(prefix string) string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return prefix + "fallback"
+	}
+	return prefix + hex.EncodeToString(buf)
+}
+
+// Listener wraps l so the relay can count wire bytes of the WebSocket
+// connections it accepts. Serve the Handler on it.
+func (s *Server) Listener(l net.Listener) net.Listener {
+	return s.metrics.Listener(l)
+}
+
+// Metrics returns the relay traffic counters.
+func (s *Server) Metrics() metrics.Snapshot {
+	return s.metrics.Snapshot()
+}
+
+// Handler serves the relay endpoints: /tunnel for connectors, /client for
+// clients, the JavaScript client under /sdk/, /healthz and /metrics.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/tunnel", s.handleTunnel)
+	mux.HandleFunc("/client", s.handleClient)
+	mux.Handle(sdk.Prefix, sdk.Handler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(s.metrics.Snapshot())
+	})
+	return mux
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"openclaw-bridge/relay/pkg/hub"
+	"openclaw-bridge/shared/protocol"
 )
 
 type Session struct {
@@ -12,6 +13,8 @@ type Session struct {
 	Client    *hub.Peer
 	Connector *hub.Peer
 	E2EE      bool
+	Version   int
+	Caps      protocol.Caps
 	CreatedAt time.Time
 }
 
@@ -0,0 +1,87 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// FlagAttachment marks a DATA frame whose payload is an attachment chunk
+// instead of a JSON event.
+const FlagAttachment byte = 1 << 1
+
+// DefaultAttachmentChunkSize keeps individual DATA frames small enough that
+// no hop has to buffer a whole file.
+const DefaultAttachmentChunkSize = 64 << 10
+
+const chunkFinal byte = 1 << 0
+
+// AttachmentChunk is one piece of a binary attachment. Chunks of an
+// attachment are sent in order; the last one has Final set.
+type AttachmentChunk struct {
+	ID     string
+	Offset uint64
+	Final  bool
+	Data   []byte
+}
+
+// EncodeAttachmentChunk lays a chunk out as
+// id_len(1) | id | offset(8, big endian) | chunk_flags(1) | data.
+func EncodeAttachmentChunk(chunk AttachmentChunk) ([]byte, error) {
+	if len(chunk.ID) == 0 {
+		return nil, fmt.Errorf("attachment id required")
+	}
+	if len(chunk.ID) > 255 {
+		return nil, fmt.Errorf("attachment id too long")
+	}
+
+	out := make([]byte, 0, 1+len(chunk.ID)+8+1+len(chunk.Data))
+	out = append(out, byte(len(chunk.ID)))
+	out = append(out, chunk.ID...)
+	out = binary.BigEndian.AppendUint64(out, chunk.Offset)
+	var flags byte
+	if chunk.Final {
+		flags |= chunkFinal
+	}
+	out = append(out, flags)
+	out = append(out, chunk.Data...)
+	return out, nil
+}
+
+func DecodeAttachmentChunk(payload []byte) (AttachmentChunk, error) {
+	if len(payload) < 1 {
+		return AttachmentChunk{}, fmt.Errorf("chunk too short")
+	}
+	idLen := int(payload[0])
+	if idLen == 0 {
+		return AttachmentChunk{}, fmt.Errorf("attachment id required")
+	}
+	if len(payload) < 1+idLen+8+1 {
+		return AttachmentChunk{}, fmt.Errorf("invalid chunk header")
+	}
+
+	pos := 1 + idLen
+	chunk := AttachmentChunk{
+		ID:     string(payload[1:pos]),
+		Offset: binary.BigEndian.Uint64(payload[pos : pos+8]),
+		Final:  payload[pos+8]&chunkFinal != 0,
+		Data:   payload[pos+9:],
+	}
+	return chunk, nil
+}
+
+// SplitAttachment cuts data into chunks of at most chunkSize bytes. An empty
+// attachment still produces a single final chunk.
+func SplitAttachment(id string, data []byte, chunkSize int) []AttachmentChunk {
+	if chunkSize <= 0 {
+		chunkSize = DefaultAttachmentChunkSize
+	}
+	chunks := make([]AttachmentChunk, 0, len(data)/chunkSize+1)
+	for offset := 0; ; offset += chunkSize {
+		end := offset + chunkSize
+		if end >= len(data) {
+			chunks = append(chunks, AttachmentChunk{ID: id, Offset: uint64(offset), Final: true, Data: data[offset:]})
+			return chunks
+		}
+		chunks = append(chunks, AttachmentChunk{ID: id, Offset: uint64(offset), Data: data[offset:end]})
+	}
+}
@@ -0,0 +1,94 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FlagCompressed marks a DATA frame whose payload is compressed with the
+// algorithm negotiated in caps.compression. CompressPayload and
+// DecompressPayload leave the other flags as they are.
+const FlagCompressed byte = 1 << 2
+
+// CompressionDeflate is raw DEFLATE (RFC 1951) without zlib or gzip framing.
+const CompressionDeflate = "deflate"
+
+// SupportedCompression lists the payload compression algorithms this build
+// implements, in order of preference.
+var SupportedCompression = []string{CompressionDeflate}
+
+// MinCompressSize is the smallest payload worth compressing; token events
+// are far below it.
+const MinCompressSize = 512
+
+// MaxDecompressedSize bounds a decompressed payload when no max_frame_size
+// was negotiated.
+const MaxDecompressedSize = 64 << 20
+
+// ErrDecompressedTooLarge is returned by DecompressPayload for a payload
+// that inflates beyond its limit.
+var ErrDecompressedTooLarge = errors.New("decompressed payload too large")
+
+// CompressionAlgorithm returns the negotiated payload compression, or "" if
+// none.
+func (c *Caps) CompressionAlgorithm() string {
+	if c == nil || len(c.Compression) == 0 {
+		return ""
+	}
+	return c.Compression[0]
+}
+
+// CompressPayload compresses payload with algorithm when that makes it
+// smaller and returns the flags to send it with. Payloads are returned
+// unchanged if algorithm is empty or compression does not pay off.
+func CompressPayload(algorithm string, flags byte, payload []byte) (byte, []byte) {
+	if algorithm != CompressionDeflate || len(payload) < MinCompressSize {
+		return flags, payload
+	}
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		return flags, payload
+	}
+	if _, err := w.Write(payload); err != nil || w.Close() != nil {
+		return flags, payload
+	}
+	if buf.Len() >= len(payload) {
+		return flags, payload
+	}
+	return flags | FlagCompressed, buf.Bytes()
+}
+
+// DecompressPayload reverses CompressPayload. Payloads without
+// FlagCompressed are returned unchanged; limit bounds the decompressed
+// size, with 0 selecting MaxDecompressedSize.
+func DecompressPayload(algorithm string, flags byte, payload []byte, limit int) (byte, []byte, error) {
+	if flags&FlagCompressed == 0 {
+		return flags, payload, nil
+	}
+	if algorithm != CompressionDeflate {
+		return flags, nil, fmt.Errorf("compressed payload without negotiated compression")
+	}
+	if limit <= 0 {
+		limit = MaxDecompressedSize
+	}
+	r := flate.NewReader(bytes.NewReader(payload))
+	defer r.Close()
+	out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return flags, nil, fmt.Errorf("decompress payload: %w", err)
+	}
+	if len(out) > limit {
+		return flags, nil, ErrDecompressedTooLarge
+	}
+	return flags &^ FlagCompressed, out, nil
+}
+
+// WireCompressible reports whether a DATA frame with flags is worth
+// permessage-deflate: compressed and encrypted payloads are not.
+func WireCompressible(flags byte) bool {
+	return flags&(FlagCompressed|FlagE2EE) == 0
+}
@@ -0,0 +1,50 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestCompressPayload(t *testing.T) {
+	text := bytes.Repeat([]byte(`{"type":"token","content":"hello"}`), 64)
+
+	flags, compressed := CompressPayload(CompressionDeflate, FlagE2EE, text)
+	if flags != FlagE2EE|FlagCompressed || len(compressed) >= len(text) {
+		t.Fatalf("flags=%d size=%d, want compressed E2EE frame smaller than %d", flags, len(compressed), len(text))
+	}
+	flags, out, err := DecompressPayload(CompressionDeflate, flags, compressed, 0)
+	if err != nil || flags != FlagE2EE || !bytes.Equal(out, text) {
+		t.Fatalf("round trip: flags=%d err=%v equal=%v", flags, err, bytes.Equal(out, text))
+	}
+
+	if flags, out := CompressPayload(CompressionDeflate, 0, []byte(`{"type":"token"}`)); flags != 0 || string(out) != `{"type":"token"}` {
+		t.Errorf("small payload compressed: flags=%d", flags)
+	}
+	if flags, _ := CompressPayload("", 0, text); flags != 0 {
+		t.Error("compressed without a negotiated algorithm")
+	}
+	random := make([]byte, 4096)
+	_, _ = rand.Read(random)
+	if flags, out := CompressPayload(CompressionDeflate, 0, random); flags != 0 || !bytes.Equal(out, random) {
+		t.Error("incompressible payload was sent compressed")
+	}
+}
+
+func TestDecompressPayloadLimits(t *testing.T) {
+	zeros := make([]byte, 1<<20)
+	flags, compressed := CompressPayload(CompressionDeflate, 0, zeros)
+	if _, _, err := DecompressPayload(CompressionDeflate, flags, compressed, 1<<10); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("limit: err = %v, want ErrDecompressedTooLarge", err)
+	}
+	if _, _, err := DecompressPayload("", flags, compressed, 0); err == nil {
+		t.Error("decompressed without a negotiated algorithm")
+	}
+	if _, _, err := DecompressPayload(CompressionDeflate, FlagCompressed, []byte("not deflate"), 0); err == nil {
+		t.Error("decompressed garbage")
+	}
+	if flags, out, err := DecompressPayload("", 0, []byte("plain"), 0); err != nil || flags != 0 || string(out) != "plain" {
+		t.Errorf("uncompressed payload: flags=%d out=%q err=%v", flags, out, err)
+	}
+}
@@ -19,8 +19,41 @@ const (
 	TypeError        = "ERROR"
 )
 
+// Caps are the capabilities a peer advertises in REGISTER or CONNECT. The
+// relay answers CONNECT_OK and SESSION_OPEN with what both sides support.
 type Caps struct {
 	E2EE bool `json:"e2ee"`
+	// Events lists optional event types: those a client wants to receive,
+	// or those a connector can emit.
+	Events []string `json:"events,omitempty"`
+	// MaxFrameSize is the largest WebSocket message in bytes the peer
+	// accepts; 0 means no limit.
+	MaxFrameSize int `json:"max_frame_size,omitempty"`
+	// SeqAck is reserved for sequenced, acknowledged delivery. No peer
+	// implements it yet, so it negotiates to false.
+	SeqAck bool `json:"seq_ack,omitempty"`
+	// Attachments means the peer handles FlagAttachment chunks.
+	Attachments bool `json:"attachments,omitempty"`
+	// Compression lists supported payload compression algorithms in order
+	// of preference.
+	Compression []string `json:"compression,omitempty"`
+}
+
+// AcceptsEvent reports whether eventType may be delivered to a peer with
+// these caps. Core events are always accepted.
+func (c *Caps) AcceptsEvent(eventType string) bool {
+	if !IsOptionalEvent(eventType) {
+		return true
+	}
+	if c == nil {
+		return false
+	}
+	for _, t := range c.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
 }
 
 type ControlMessage struct {
@@ -34,6 +67,9 @@ type ControlMessage struct {
 	Caps           *Caps  `json:"caps,omitempty"`
 	Code           string `json:"code,omitempty"`
 	Message        string `json:"message,omitempty"`
+	// Versions lists the protocol versions offered in REGISTER and CONNECT.
+	// Handshakes are sent with V set to the oldest of them.
+	Versions []int `json:"versions,omitempty"`
 }
 
 func DecodeControl(data []byte) (ControlMessage, error) {
@@ -45,7 +81,10 @@ func DecodeControl(data []byte) (ControlMessage, error) {
 		return ControlMessage{}, fmt.Errorf("missing type")
 	}
 	if msg.V == 0 {
-		msg.V = Version
+		return msg, ErrMissingVersion
+	}
+	if !IsSupportedVersion(msg.V) {
+		return msg, &VersionError{Offered: msg.OfferedVersions(), Supported: SupportedVersions}
 	}
 	return msg, nil
 }
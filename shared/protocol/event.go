@@ -10,20 +10,104 @@ const (
 	EventToken       = "token"
 	EventEnd         = "end"
 	EventError       = "error"
+	EventStatus      = "status"
+	EventToolCall    = "tool_call"
+	EventToolResult  = "tool_result"
+	EventReasoning   = "reasoning"
+	EventMedia       = "media"
 )
 
+// OptionalEvents are only delivered to clients that list them in
+// Caps.Events when connecting.
+var OptionalEvents = []string{EventToolCall, EventToolResult, EventReasoning, EventStatus, EventMedia}
+
+func IsOptionalEvent(eventType string) bool {
+	for _, t := range OptionalEvents {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// RunMeta summarises a finished run and is attached to end events.
+type RunMeta struct {
+	RunID        string `json:"runId,omitempty"`
+	Model        string `json:"model,omitempty"`
+	Provider     string `json:"provider,omitempty"`
+	StopReason   string `json:"stopReason,omitempty"`
+	Usage        *Usage `json:"usage,omitempty"`
+	DurationMs   int64  `json:"durationMs,omitempty"`
+	FirstTokenMs int64  `json:"firstTokenMs,omitempty"`
+}
+
+// Usage holds token counts as reported by the model provider.
+type Usage struct {
+	InputTokens      int64 `json:"inputTokens,omitempty"`
+	OutputTokens     int64 `json:"outputTokens,omitempty"`
+	CacheReadTokens  int64 `json:"cacheReadTokens,omitempty"`
+	CacheWriteTokens int64 `json:"cacheWriteTokens,omitempty"`
+	TotalTokens      int64 `json:"totalTokens,omitempty"`
+}
+
 type ImageItem struct {
 	Data     string `json:"data,omitempty"`
 	MimeType string `json:"mimeType,omitempty"`
 }
 
+// FileItem is a non-image file passed inline as base64.
+type FileItem struct {
+	Data     string `json:"data,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// AttachmentRef points a user_message at an attachment uploaded beforehand
+// as FlagAttachment chunks. The connector resolves refs into Images and Files
+// before the event is sent to the gateway.
+type AttachmentRef struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mimeType,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Size     int64  `json:"size"`
+}
+
+// MediaInfo describes an image or file produced by the agent. Content is
+// either inline base64 (Data), a remote URL, or the id of an attachment
+// streamed to the client as FlagAttachment chunks before this event.
+type MediaInfo struct {
+	MimeType     string `json:"mimeType,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Data         string `json:"data,omitempty"`
+	URL          string `json:"url,omitempty"`
+	AttachmentID string `json:"attachmentId,omitempty"`
+}
+
+// ToolInfo describes an agent tool invocation (tool_call) or its outcome
+// (tool_result).
+type ToolInfo struct {
+	CallID  string          `json:"callId,omitempty"`
+	Name    string          `json:"name,omitempty"`
+	Args    json.RawMessage `json:"args,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	IsError bool            `json:"isError,omitempty"`
+}
+
 type Event struct {
-	Type    string      `json:"type"`
-	Content string      `json:"content,omitempty"`
-	Images  []ImageItem `json:"images,omitempty"`
-	Action  string      `json:"action,omitempty"`
-	Code    string      `json:"code,omitempty"`
-	Message string      `json:"message,omitempty"`
+	Type        string          `json:"type"`
+	ID          string          `json:"id,omitempty"`
+	Content     string          `json:"content,omitempty"`
+	Images      []ImageItem     `json:"images,omitempty"`
+	Files       []FileItem      `json:"files,omitempty"`
+	Attachments []AttachmentRef `json:"attachments,omitempty"`
+	Action      string          `json:"action,omitempty"`
+	Code        string          `json:"code,omitempty"`
+	Message     string          `json:"message,omitempty"`
+	Status      string          `json:"status,omitempty"`
+	Tool        *ToolInfo       `json:"tool,omitempty"`
+	Media       *MediaInfo      `json:"media,omitempty"`
+	Meta        *RunMeta        `json:"meta,omitempty"`
 }
 
 func EncodeEvent(event Event) ([]byte, error) {
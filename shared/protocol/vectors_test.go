@@ -0,0 +1,248 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testdata/vectors.json is shared with the JavaScript client in web/sdk,
+// whose tests decode and re-encode the same vectors. Regenerate it after a
+// wire format change with: go test ./shared/protocol -update
+var update = flag.Bool("update", false, "rewrite testdata/vectors.json")
+
+const vectorsPath = "testdata/vectors.json"
+
+type vectors struct {
+	Version           int             `json:"version"`
+	SupportedVersions []int           `json:"supported_versions"`
+	Flags             map[string]byte `json:"flags"`
+	ControlTypes      []string        `json:"control_types"`
+	EventTypes        []string        `json:"event_types"`
+	OptionalEvents    []string        `json:"optional_events"`
+
+	DataFrames              []dataFrameVector `json:"data_frames"`
+	InvalidDataFrames       []invalidVector   `json:"invalid_data_frames"`
+	AttachmentChunks        []chunkVector     `json:"attachment_chunks"`
+	InvalidAttachmentChunks []invalidVector   `json:"invalid_attachment_chunks"`
+	Controls                []controlVector   `json:"controls"`
+	InvalidControls         []invalidControl  `json:"invalid_controls"`
+}
+
+type dataFrameVector struct {
+	Name      string `json:"name"`
+	SessionID string `json:"session_id"`
+	Flags     byte   `json:"flags"`
+	Payload   string `json:"payload_hex"`
+	Frame     string `json:"frame_hex"`
+}
+
+type chunkVector struct {
+	Name   string `json:"name"`
+	ID     string `json:"id"`
+	Offset uint64 `json:"offset"`
+	Final  bool   `json:"final"`
+	Data   string `json:"data_hex"`
+	Chunk  string `json:"chunk_hex"`
+}
+
+type invalidVector struct {
+	Name  string `json:"name"`
+	Bytes string `json:"hex"`
+}
+
+// controlVector pairs a control message as sent on the wire with its
+// decoded form; encoding Decoded must give the same JSON object.
+type controlVector struct {
+	Name    string         `json:"name"`
+	JSON    string         `json:"json"`
+	Decoded ControlMessage `json:"decoded"`
+}
+
+type invalidControl struct {
+	Name string `json:"name"`
+	JSON string `json:"json"`
+}
+
+func generateVectors(t *testing.T) vectors {
+	t.Helper()
+	event := func(ev Event) []byte {
+		data, err := EncodeEvent(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	chunk := func(c AttachmentChunk) []byte {
+		data, err := EncodeAttachmentChunk(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	v := vectors{
+		Version:           Version,
+		SupportedVersions: SupportedVersions,
+		Flags:             map[string]byte{"e2ee": FlagE2EE, "attachment": FlagAttachment, "compressed": FlagCompressed},
+		ControlTypes:      []string{TypeRegister, TypeConnect, TypeConnectOK, TypeSessionOpen, TypeCloseSession, TypeHeartbeat, TypeError},
+		EventTypes: []string{EventUserMessage, EventToken, EventEnd, EventError, EventStatus,
+			EventToolCall, EventToolResult, EventReasoning, EventMedia},
+		OptionalEvents: OptionalEvents,
+	}
+
+	frames := []struct {
+		name      string
+		sessionID string
+		flags     byte
+		payload   []byte
+	}{
+		{"user message", "s_0123456789abcdef", 0, event(Event{Type: EventUserMessage, ID: "m1", Content: "hello"})},
+		{"token with multibyte text", "s_1", 0, event(Event{Type: EventToken, ID: "m1", Content: "你好 👋"})},
+		{"stop control", "s_1", 0, event(Event{Type: "control", Action: "stop", ID: "m1"})},
+		{"end with meta", "s_1", 0, event(Event{Type: EventEnd, ID: "m1", Meta: &RunMeta{RunID: "run_1", StopReason: "stop", Usage: &Usage{OutputTokens: 2, TotalTokens: 2}}})},
+		{"e2ee payload", "s_1", FlagE2EE, []byte{0x00, 0xff, 0x10, 0x80}},
+		{"compressed e2ee payload", "s_1", FlagCompressed | FlagE2EE, []byte{0x4b, 0x04, 0x00}},
+		{"attachment chunk", "s_1", FlagAttachment, chunk(AttachmentChunk{ID: "a1", Final: true, Data: []byte("png")})},
+		{"empty payload", "s", 0, nil},
+		{"max session id", string(bytes.Repeat([]byte("x"), 255)), 0, []byte("{}")},
+	}
+	for _, f := range frames {
+		frame, err := BuildDataFrame(f.sessionID, f.flags, f.payload)
+		if err != nil {
+			t.Fatalf("%s: %v", f.name, err)
+		}
+		v.DataFrames = append(v.DataFrames, dataFrameVector{f.name, f.sessionID, f.flags, hex.EncodeToString(f.payload), hex.EncodeToString(frame)})
+	}
+	v.InvalidDataFrames = []invalidVector{
+		{"empty", ""},
+		{"too short", "0161"},
+		{"zero sid_len", "000000"},
+		{"sid_len beyond frame", "05616200"},
+	}
+
+	chunks := []struct {
+		name  string
+		chunk AttachmentChunk
+	}{
+		{"single final chunk", AttachmentChunk{ID: "a1", Final: true, Data: []byte("hello")}},
+		{"middle chunk", AttachmentChunk{ID: "att_42", Offset: 65536, Data: []byte{0, 1, 2, 3}}},
+		{"large offset", AttachmentChunk{ID: "a", Offset: 1 << 40, Final: true, Data: []byte{0xfe}}},
+		{"empty final chunk", AttachmentChunk{ID: "a2", Final: true}},
+	}
+	for _, c := range chunks {
+		v.AttachmentChunks = append(v.AttachmentChunks, chunkVector{c.name, c.chunk.ID, c.chunk.Offset, c.chunk.Final, hex.EncodeToString(c.chunk.Data), hex.EncodeToString(chunk(c.chunk))})
+	}
+	v.InvalidAttachmentChunks = []invalidVector{
+		{"empty", ""},
+		{"zero id_len", "00000000000000000000"},
+		{"truncated header", "0261620000000000000000"},
+	}
+
+	controls := []struct {
+		name string
+		json string
+	}{
+		{"connect", `{"type":"CONNECT","v":1,"access_code":"A-123456","caps":{"e2ee":false,"events":["reasoning","media"]}}`},
+		{"connect with versions and caps", `{"type":"CONNECT","v":1,"access_code":"A-1","caps":{"e2ee":false,"max_frame_size":1048576,"attachments":true,"compression":["deflate"]},"versions":[1]}`},
+		{"connect ok", `{"type":"CONNECT_OK","v":1,"session_id":"s_1","caps":{"e2ee":false,"attachments":true}}`},
+		{"error", `{"type":"ERROR","v":1,"code":"CONNECTOR_NOT_FOUND","message":"connector not online"}`},
+		{"close session", `{"type":"CLOSE_SESSION","v":1,"session_id":"s_1"}`},
+		{"heartbeat", `{"type":"HEARTBEAT","v":1}`},
+	}
+	for _, c := range controls {
+		msg, err := DecodeControl([]byte(c.json))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		v.Controls = append(v.Controls, controlVector{c.name, c.json, msg})
+	}
+	v.InvalidControls = []invalidControl{
+		{"not json", `HEARTBEAT`},
+		{"missing type", `{"v":1}`},
+		{"missing version", `{"type":"HEARTBEAT"}`},
+		{"unsupported version", `{"type":"CONNECT","v":99,"versions":[99],"access_code":"A-1"}`},
+	}
+	return v
+}
+
+func TestVectors(t *testing.T) {
+	want, err := json.MarshalIndent(generateVectors(t), "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, '\n')
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(vectorsPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(vectorsPath, want, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := os.ReadFile(vectorsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.ReplaceAll(got, []byte("\r\n"), []byte("\n")), want) {
+		t.Fatalf("%s is stale; run go test ./shared/protocol -update", vectorsPath)
+	}
+
+	var v vectors
+	if err := json.Unmarshal(got, &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range v.DataFrames {
+		sid, flags, payload, err := ParseDataFrame(mustHex(t, f.Frame))
+		if err != nil || sid != f.SessionID || flags != f.Flags || hex.EncodeToString(payload) != f.Payload {
+			t.Errorf("%s: parsed sid=%q flags=%d payload=%x err=%v", f.Name, sid, flags, payload, err)
+		}
+	}
+	for _, f := range v.InvalidDataFrames {
+		if _, _, _, err := ParseDataFrame(mustHex(t, f.Bytes)); err == nil {
+			t.Errorf("%s: parsed without error", f.Name)
+		}
+	}
+	for _, c := range v.AttachmentChunks {
+		chunk, err := DecodeAttachmentChunk(mustHex(t, c.Chunk))
+		if err != nil || chunk.ID != c.ID || chunk.Offset != c.Offset || chunk.Final != c.Final || hex.EncodeToString(chunk.Data) != c.Data {
+			t.Errorf("%s: decoded %+v err=%v", c.Name, chunk, err)
+		}
+	}
+	for _, c := range v.InvalidAttachmentChunks {
+		if _, err := DecodeAttachmentChunk(mustHex(t, c.Bytes)); err == nil {
+			t.Errorf("%s: decoded without error", c.Name)
+		}
+	}
+	for _, c := range v.Controls {
+		data, err := EncodeControl(c.Decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got, want map[string]any
+		_ = json.Unmarshal(data, &got)
+		_ = json.Unmarshal([]byte(c.JSON), &want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: encoded %s, want %s", c.Name, data, c.JSON)
+		}
+	}
+	for _, c := range v.InvalidControls {
+		if _, err := DecodeControl([]byte(c.JSON)); err == nil {
+			t.Errorf("%s: decoded without error", c.Name)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,104 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// SupportedVersions lists the protocol versions this build speaks, oldest
+// first. Version is the newest of them.
+var SupportedVersions = []int{Version}
+
+// ErrMissingVersion is returned by DecodeControl for a message without "v".
+var ErrMissingVersion = errors.New("missing protocol version")
+
+// VersionError reports that two sides share no protocol version.
+type VersionError struct {
+	Offered   []int
+	Supported []int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("unsupported protocol version: offered %v, supported %v", e.Offered, e.Supported)
+}
+
+// IsSupportedVersion reports whether v is in SupportedVersions.
+func IsSupportedVersion(v int) bool {
+	return slices.Contains(SupportedVersions, v)
+}
+
+// OfferedVersions returns the versions a REGISTER or CONNECT advertises.
+// Peers that predate negotiation send no list and speak only msg.V.
+func (m ControlMessage) OfferedVersions() []int {
+	if len(m.Versions) > 0 {
+		return m.Versions
+	}
+	return []int{m.V}
+}
+
+// NegotiateVersion returns the newest version present in every list.
+func NegotiateVersion(offers ...[]int) (int, bool) {
+	best := 0
+	for _, v := range SupportedVersions {
+		common := true
+		for _, offer := range offers {
+			if !slices.Contains(offer, v) {
+				common = false
+				break
+			}
+		}
+		if common {
+			best = v
+		}
+	}
+	return best, best != 0
+}
+
+// LegacyCaps returns the capabilities of a peer whose handshake carried no
+// version list. Those peers handled attachment chunks without saying so.
+func LegacyCaps(c *Caps) Caps {
+	var caps Caps
+	if c != nil {
+		caps = *c
+	}
+	caps.Attachments = true
+	return caps
+}
+
+// IntersectCaps returns what a client and a connector both support. A
+// connector that lists no events does not restrict the client's choice.
+// maxFrameSize is the relay's own limit; 0 means none.
+func IntersectCaps(client, connector Caps, maxFrameSize int) Caps {
+	caps := Caps{
+		E2EE:         client.E2EE && connector.E2EE,
+		Events:       client.Events,
+		MaxFrameSize: minFrameSize(minFrameSize(client.MaxFrameSize, connector.MaxFrameSize), maxFrameSize),
+		SeqAck:       client.SeqAck && connector.SeqAck,
+		Attachments:  client.Attachments && connector.Attachments,
+	}
+	if connector.Events != nil {
+		caps.Events = intersect(client.Events, connector.Events)
+	}
+	caps.Compression = intersect(client.Compression, connector.Compression)
+	return caps
+}
+
+// minFrameSize returns the smaller limit, where 0 means no limit.
+func minFrameSize(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// intersect keeps the entries of a that are also in b, in a's order.
+func intersect(a, b []string) []string {
+	var out []string
+	for _, s := range a {
+		if slices.Contains(b, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNegotiateVersion(t *testing.T) {
+	cases := []struct {
+		name   string
+		offers [][]int
+		want   int
+		ok     bool
+	}{
+		{"same version", [][]int{{1}, {1}}, 1, true},
+		{"newer peer also speaks 1", [][]int{{1, 2}, {1}}, 1, true},
+		{"no common version", [][]int{{2}, {1}}, 0, false},
+		{"empty offer", [][]int{{}}, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := NegotiateVersion(c.offers...)
+		if got != c.want || ok != c.ok {
+			t.Errorf("%s: got (%d, %v), want (%d, %v)", c.name, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestDecodeControlVersion(t *testing.T) {
+	if _, err := DecodeControl([]byte(`{"type":"HEARTBEAT"}`)); !errors.Is(err, ErrMissingVersion) {
+		t.Errorf("missing v: err = %v, want ErrMissingVersion", err)
+	}
+	msg, err := DecodeControl([]byte(`{"type":"CONNECT","v":3,"versions":[3,4]}`))
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) || !reflect.DeepEqual(versionErr.Offered, []int{3, 4}) {
+		t.Errorf("unsupported v: err = %v, want VersionError offering [3 4]", err)
+	}
+	if msg.Type != TypeConnect {
+		t.Errorf("unsupported v: type %q not returned with the error", msg.Type)
+	}
+}
+
+func TestIntersectCaps(t *testing.T) {
+	client := Caps{
+		E2EE:         true,
+		Events:       []string{EventReasoning, EventMedia},
+		MaxFrameSize: 1 << 20,
+		SeqAck:       true,
+		Attachments:  true,
+		Compression:  []string{"zstd", "deflate"},
+	}
+	connector := Caps{
+		E2EE:         true,
+		Events:       []string{EventMedia, EventToolCall},
+		MaxFrameSize: 4 << 20,
+		Attachments:  true,
+		Compression:  []string{"deflate", "zstd"},
+	}
+	got := IntersectCaps(client, connector, 512<<10)
+	want := Caps{
+		E2EE:         true,
+		Events:       []string{EventMedia},
+		MaxFrameSize: 512 << 10,
+		Attachments:  true,
+		Compression:  []string{"zstd", "deflate"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("IntersectCaps = %+v, want %+v", got, want)
+	}
+
+	// A connector that lists no events does not filter the client's.
+	got = IntersectCaps(Caps{Events: []string{EventReasoning}, MaxFrameSize: 100}, Caps{}, 0)
+	if !reflect.DeepEqual(got.Events, []string{EventReasoning}) || got.MaxFrameSize != 100 || got.Attachments {
+		t.Errorf("IntersectCaps with empty connector = %+v", got)
+	}
+}
+
+func TestLegacyCaps(t *testing.T) {
+	if got := LegacyCaps(nil); !got.Attachments {
+		t.Error("LegacyCaps(nil) does not allow attachments")
+	}
+	in := &Caps{E2EE: true}
+	if got := LegacyCaps(in); !got.E2EE || !got.Attachments || in.Attachments {
+		t.Errorf("LegacyCaps = %+v, input %+v", got, in)
+	}
+}
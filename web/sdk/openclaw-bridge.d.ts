@@ -0,0 +1,203 @@
+// Type declarations for openclaw-bridge.js.
+
+export const PROTOCOL_VERSION: number;
+export const SUPPORTED_VERSIONS: readonly number[];
+export const FLAG_E2EE: number;
+export const FLAG_ATTACHMENT: number;
+export const FLAG_COMPRESSED: number;
+export const ATTACHMENT_CHUNK_SIZE: number;
+
+export const ControlType: Readonly<{
+  REGISTER: "REGISTER";
+  CONNECT: "CONNECT";
+  CONNECT_OK: "CONNECT_OK";
+  SESSION_OPEN: "SESSION_OPEN";
+  CLOSE_SESSION: "CLOSE_SESSION";
+  HEARTBEAT: "HEARTBEAT";
+  ERROR: "ERROR";
+}>;
+
+export const EventType: Readonly<{
+  USER_MESSAGE: "user_message";
+  TOKEN: "token";
+  END: "end";
+  ERROR: "error";
+  STATUS: "status";
+  TOOL_CALL: "tool_call";
+  TOOL_RESULT: "tool_result";
+  REASONING: "reasoning";
+  MEDIA: "media";
+}>;
+
+export const OPTIONAL_EVENTS: readonly string[];
+
+export interface Caps {
+  e2ee: boolean;
+  events?: string[];
+  /** Largest WebSocket message in bytes; absent means no limit. */
+  max_frame_size?: number;
+  /** Reserved; always negotiates to false. */
+  seq_ack?: boolean;
+  attachments?: boolean;
+  compression?: string[];
+}
+
+export interface ControlMessage {
+  type: string;
+  v: number;
+  access_code_hash?: string;
+  access_code?: string;
+  generation?: number;
+  session_id?: string;
+  e2ee?: boolean;
+  caps?: Caps;
+  code?: string;
+  message?: string;
+  versions?: number[];
+}
+
+export interface Usage {
+  inputTokens?: number;
+  outputTokens?: number;
+  cacheReadTokens?: number;
+  cacheWriteTokens?: number;
+  totalTokens?: number;
+}
+
+export interface RunMeta {
+  runId?: string;
+  model?: string;
+  provider?: string;
+  stopReason?: string;
+  usage?: Usage;
+  durationMs?: number;
+  firstTokenMs?: number;
+}
+
+export interface ImageItem {
+  data?: string;
+  mimeType?: string;
+}
+
+export interface FileItem {
+  data?: string;
+  mimeType?: string;
+  name?: string;
+}
+
+export interface AttachmentRef {
+  id: string;
+  mimeType?: string;
+  name?: string;
+  size: number;
+}
+
+export interface ToolInfo {
+  name?: string;
+  callId?: string;
+  args?: unknown;
+  result?: unknown;
+  isError?: boolean;
+}
+
+export interface MediaInfo {
+  mimeType?: string;
+  name?: string;
+  size?: number;
+  data?: string;
+  url?: string;
+  attachmentId?: string;
+  /** Content of a streamed attachment, set by BridgeClient in place of attachmentId. */
+  bytes?: Uint8Array;
+}
+
+export interface Event {
+  type: string;
+  id?: string;
+  content?: string;
+  images?: ImageItem[];
+  files?: FileItem[];
+  attachments?: AttachmentRef[];
+  action?: string;
+  code?: string;
+  message?: string;
+  status?: string;
+  tool?: ToolInfo;
+  media?: MediaInfo;
+  meta?: RunMeta;
+}
+
+export interface DataFrame {
+  sessionId: string;
+  flags: number;
+  payload: Uint8Array;
+}
+
+export interface AttachmentChunk {
+  id: string;
+  offset: number;
+  final: boolean;
+  data: Uint8Array;
+}
+
+type Bytes = ArrayBuffer | ArrayBufferView;
+
+export function buildDataFrame(sessionId: string, flags: number, payload?: Bytes): Uint8Array;
+export function parseDataFrame(data: Bytes): DataFrame;
+export function encodeAttachmentChunk(chunk: { id: string; offset?: number; final?: boolean; data?: Bytes }): Uint8Array;
+export function decodeAttachmentChunk(data: Bytes): AttachmentChunk;
+export function splitAttachment(id: string, data: Bytes, chunkSize?: number): AttachmentChunk[];
+export function encodeControl(msg: Partial<ControlMessage> & { type: string }): string;
+export function decodeControl(text: string): ControlMessage;
+export function encodeEvent(event: Event): Uint8Array;
+export function decodeEvent(payload: Bytes): Event;
+
+export class ConnectError extends Error {
+  code: string;
+  detail: string;
+}
+
+export class ClosedError extends Error {}
+
+export interface BridgeClientOptions {
+  caps?: Caps;
+  /** Open a new session when the connection drops. Runs in flight get a CONNECTION_LOST error event. */
+  reconnect?: boolean;
+  /** Pause between reconnect attempts in milliseconds. Default 2000. */
+  reconnectDelay?: number;
+  /** WebSocket constructor for environments without a global one. */
+  WebSocket?: unknown;
+}
+
+export interface BridgeClientEventMap {
+  event: CustomEvent<Event>;
+  disconnect: CustomEvent<Error>;
+  reconnect: CustomEvent<string>;
+  close: CustomEvent<Error | null>;
+}
+
+export class BridgeClient extends EventTarget {
+  constructor(url: string, accessCode: string, options?: BridgeClientOptions);
+  readonly sessionId: string;
+  /** Capabilities negotiated in CONNECT_OK. */
+  readonly caps: Caps | null;
+  /** Protocol version negotiated in CONNECT_OK. */
+  readonly version: number;
+  readonly closed: boolean;
+  readonly error: Error | null;
+  connect(): Promise<string>;
+  send(event: Event): Promise<void>;
+  stop(eventId?: string): Promise<void>;
+  uploadAttachment(data: Blob | Bytes, info?: { mimeType?: string; name?: string }): Promise<AttachmentRef>;
+  close(): void;
+  addEventListener<K extends keyof BridgeClientEventMap>(
+    type: K,
+    listener: (ev: BridgeClientEventMap[K]) => void,
+    options?: boolean | AddEventListenerOptions,
+  ): void;
+  removeEventListener<K extends keyof BridgeClientEventMap>(
+    type: K,
+    listener: (ev: BridgeClientEventMap[K]) => void,
+    options?: boolean | EventListenerOptions,
+  ): void;
+}
@@ -0,0 +1,591 @@
+// OpenClawBridge client for browsers and Node. It speaks the relay client
+// protocol described in docs/protocol.md; the codecs are checked against the
+// Go implementation with shared/protocol/testdata/vectors.json.
+//
+//   import { BridgeClient } from "https://RELAY/sdk/v1/openclaw-bridge.js";
+//   const client = new BridgeClient("wss://RELAY/client", "A-123456", { reconnect: true });
+//   client.addEventListener("event", (e) => console.log(e.detail));
+//   await client.connect();
+//   await client.send({ type: "user_message", id: "m1", content: "hello" });
+
+export const PROTOCOL_VERSION = 1;
+
+// SUPPORTED_VERSIONS are offered in CONNECT, oldest first.
+export const SUPPORTED_VERSIONS = Object.freeze([1]);
+
+export const FLAG_E2EE = 1 << 0;
+export const FLAG_ATTACHMENT = 1 << 1;
+// FLAG_COMPRESSED marks a payload compressed with the negotiated algorithm.
+// This client does not offer caps.compression, so it never receives one.
+export const FLAG_COMPRESSED = 1 << 2;
+
+export const ATTACHMENT_CHUNK_SIZE = 64 * 1024;
+
+export const ControlType = Object.freeze({
+  REGISTER: "REGISTER",
+  CONNECT: "CONNECT",
+  CONNECT_OK: "CONNECT_OK",
+  SESSION_OPEN: "SESSION_OPEN",
+  CLOSE_SESSION: "CLOSE_SESSION",
+  HEARTBEAT: "HEARTBEAT",
+  ERROR: "ERROR",
+});
+
+export const EventType = Object.freeze({
+  USER_MESSAGE: "user_message",
+  TOKEN: "token",
+  END: "end",
+  ERROR: "error",
+  STATUS: "status",
+  TOOL_CALL: "tool_call",
+  TOOL_RESULT: "tool_result",
+  REASONING: "reasoning",
+  MEDIA: "media",
+});
+
+// Optional events are only delivered when listed in caps.events.
+export const OPTIONAL_EVENTS = Object.freeze([
+  EventType.TOOL_CALL,
+  EventType.TOOL_RESULT,
+  EventType.REASONING,
+  EventType.STATUS,
+  EventType.MEDIA,
+]);
+
+const encoder = new TextEncoder();
+const decoder = new TextDecoder();
+const CHUNK_FINAL = 1 << 0;
+
+function toBytes(data) {
+  if (data instanceof Uint8Array) {
+    return data;
+  }
+  if (data instanceof ArrayBuffer) {
+    return new Uint8Array(data);
+  }
+  if (ArrayBuffer.isView(data)) {
+    return new Uint8Array(data.buffer, data.byteOffset, data.byteLength);
+  }
+  throw new TypeError("expected ArrayBuffer or Uint8Array");
+}
+
+// buildDataFrame lays a DATA frame out as sid_len(1) | sid | flags(1) | payload.
+export function buildDataFrame(sessionId, flags, payload = new Uint8Array()) {
+  const sid = encoder.encode(sessionId);
+  if (!sid.length) {
+    throw new Error("session_id required");
+  }
+  if (sid.length > 255) {
+    throw new Error("session_id too long");
+  }
+  const body = toBytes(payload);
+  const frame = new Uint8Array(1 + sid.length + 1 + body.length);
+  frame[0] = sid.length;
+  frame.set(sid, 1);
+  frame[1 + sid.length] = flags;
+  frame.set(body, 2 + sid.length);
+  return frame;
+}
+
+export function parseDataFrame(data) {
+  const frame = toBytes(data);
+  if (frame.length < 3) {
+    throw new Error("frame too short");
+  }
+  const sidLen = frame[0];
+  if (!sidLen) {
+    throw new Error("sid_len must be > 0");
+  }
+  if (frame.length < 1 + sidLen + 1) {
+    throw new Error("invalid frame header");
+  }
+  return {
+    sessionId: decoder.decode(frame.subarray(1, 1 + sidLen)),
+    flags: frame[1 + sidLen],
+    payload: frame.subarray(2 + sidLen),
+  };
+}
+
+// encodeAttachmentChunk lays a chunk out as
+// id_len(1) | id | offset(8, big endian) | chunk_flags(1) | data.
+export function encodeAttachmentChunk({ id, offset = 0, final = false, data = new Uint8Array() }) {
+  const idBytes = encoder.encode(id || "");
+  if (!idBytes.length) {
+    throw new Error("attachment id required");
+  }
+  if (idBytes.length > 255) {
+    throw new Error("attachment id too long");
+  }
+  const body = toBytes(data);
+  const out = new Uint8Array(1 + idBytes.length + 9 + body.length);
+  out[0] = idBytes.length;
+  out.set(idBytes, 1);
+  new DataView(out.buffer).setBigUint64(1 + idBytes.length, BigInt(offset));
+  out[1 + idBytes.length + 8] = final ? CHUNK_FINAL : 0;
+  out.set(body, 1 + idBytes.length + 9);
+  return out;
+}
+
+export function decodeAttachmentChunk(data) {
+  const payload = toBytes(data);
+  if (payload.length < 1) {
+    throw new Error("chunk too short");
+  }
+  const idLen = payload[0];
+  if (!idLen) {
+    throw new Error("attachment id required");
+  }
+  if (payload.length < 1 + idLen + 9) {
+    throw new Error("invalid chunk header");
+  }
+  const pos = 1 + idLen;
+  const view = new DataView(payload.buffer, payload.byteOffset, payload.byteLength);
+  return {
+    id: decoder.decode(payload.subarray(1, pos)),
+    offset: Number(view.getBigUint64(pos)),
+    final: (payload[pos + 8] & CHUNK_FINAL) !== 0,
+    data: payload.subarray(pos + 9),
+  };
+}
+
+// splitAttachment cuts data into chunks of at most chunkSize bytes. An empty
+// attachment still produces a single final chunk.
+export function splitAttachment(id, data, chunkSize = ATTACHMENT_CHUNK_SIZE) {
+  const bytes = toBytes(data);
+  const chunks = [];
+  for (let offset = 0; ; offset += chunkSize) {
+    const end = offset + chunkSize;
+    if (end >= bytes.length) {
+      chunks.push({ id, offset, final: true, data: bytes.subarray(offset) });
+      return chunks;
+    }
+    chunks.push({ id, offset, final: false, data: bytes.subarray(offset, end) });
+  }
+}
+
+export function encodeControl(msg) {
+  return JSON.stringify({ ...msg, v: msg.v || PROTOCOL_VERSION });
+}
+
+export function decodeControl(text) {
+  const msg = JSON.parse(text);
+  if (!msg || typeof msg !== "object" || !msg.type) {
+    throw new Error("missing type");
+  }
+  if (!msg.v) {
+    throw new Error("missing protocol version");
+  }
+  if (!SUPPORTED_VERSIONS.includes(msg.v)) {
+    throw new Error(`unsupported protocol version ${msg.v}`);
+  }
+  return msg;
+}
+
+export function encodeEvent(event) {
+  return encoder.encode(JSON.stringify(event));
+}
+
+export function decodeEvent(payload) {
+  const event = JSON.parse(decoder.decode(toBytes(payload)));
+  if (!event || typeof event !== "object" || !event.type) {
+    throw new Error("missing type");
+  }
+  return event;
+}
+
+// ConnectError is an ERROR control message received while connecting, for
+// example code CONNECTOR_NOT_FOUND.
+export class ConnectError extends Error {
+  constructor(code, message) {
+    super(`connect error ${code}: ${message}`);
+    this.name = "ConnectError";
+    this.code = code;
+    this.detail = message;
+  }
+}
+
+// ClosedError is thrown by send, stop and uploadAttachment after the
+// session has ended.
+export class ClosedError extends Error {
+  constructor(message = "session closed") {
+    super(message);
+    this.name = "ClosedError";
+  }
+}
+
+// MediaAssembler collects attachment chunks streamed ahead of media events.
+class MediaAssembler {
+  #partial = new Map();
+  #complete = new Map();
+
+  add(payload) {
+    let chunk;
+    try {
+      chunk = decodeAttachmentChunk(payload);
+    } catch {
+      return;
+    }
+    const parts = this.#partial.get(chunk.id) || { size: 0, parts: [] };
+    if (parts.size !== chunk.offset) {
+      this.#partial.delete(chunk.id);
+      return;
+    }
+    parts.parts.push(chunk.data.slice());
+    parts.size += chunk.data.length;
+    if (!chunk.final) {
+      this.#partial.set(chunk.id, parts);
+      return;
+    }
+    this.#partial.delete(chunk.id);
+    const bytes = new Uint8Array(parts.size);
+    let pos = 0;
+    for (const part of parts.parts) {
+      bytes.set(part, pos);
+      pos += part.length;
+    }
+    this.#complete.set(chunk.id, bytes);
+  }
+
+  // resolve replaces media.attachmentId with the streamed content in
+  // media.bytes.
+  resolve(event) {
+    const id = event.media && event.media.attachmentId;
+    if (!id || !this.#complete.has(id)) {
+      return;
+    }
+    const { attachmentId, ...media } = event.media;
+    media.bytes = this.#complete.get(attachmentId);
+    this.#complete.delete(attachmentId);
+    event.media = media;
+  }
+}
+
+// BridgeClient is one client session on the relay. It dispatches:
+//   "event"      detail: a protocol event, in order
+//   "disconnect" detail: the Error that dropped the connection
+//   "reconnect"  detail: the new session id
+//   "close"      detail: null after close(), otherwise the final Error
+export class BridgeClient extends EventTarget {
+  #url;
+  #accessCode;
+  #options;
+  #ws = null;
+  #sessionId = "";
+  #caps = null;
+  #version = 0;
+  #media = null;
+  #inflight = new Map();
+  #started = false;
+  #closed = false;
+  #error = null;
+  #ready;
+  #readyResolve;
+  #attachmentSeq = 0;
+
+  // options: caps, reconnect (false), reconnectDelay (2000 ms) and
+  // WebSocket, the constructor to use where there is no global one.
+  constructor(url, accessCode, options = {}) {
+    super();
+    this.#url = url;
+    this.#accessCode = accessCode;
+    this.#options = { reconnect: false, reconnectDelay: 2000, WebSocket: globalThis.WebSocket, ...options };
+    if (!this.#options.WebSocket) {
+      throw new Error("no WebSocket implementation; pass options.WebSocket");
+    }
+    this.#resetReady();
+  }
+
+  // sessionId changes after a reconnect.
+  get sessionId() {
+    return this.#sessionId;
+  }
+
+  // caps are the capabilities negotiated in CONNECT_OK: what the client,
+  // the relay and the connector all support.
+  get caps() {
+    return this.#caps;
+  }
+
+  // version is the protocol version negotiated in CONNECT_OK.
+  get version() {
+    return this.#version;
+  }
+
+  get closed() {
+    return this.#closed;
+  }
+
+  // error is why the session ended, or null.
+  get error() {
+    return this.#error;
+  }
+
+  // connect opens the session and resolves with its id. It rejects with a
+  // ConnectError when the relay refuses the access code.
+  async connect() {
+    if (this.#started) {
+      throw new Error("already connected");
+    }
+    this.#started = true;
+    try {
+      this.#attach(await this.#handshake());
+    } catch (err) {
+      this.#finish(err);
+      throw err;
+    }
+    return this.#sessionId;
+  }
+
+  // send writes event to the session. While a reconnect is in progress it
+  // waits for the new session.
+  async send(event) {
+    const ws = await this.#connected();
+    const frame = buildDataFrame(this.#sessionId, 0, encodeEvent(event));
+    const limit = this.#caps?.max_frame_size;
+    if (limit && frame.length > limit) {
+      throw new Error(`frame of ${frame.length} bytes exceeds max_frame_size ${limit}`);
+    }
+    if (event.type === EventType.USER_MESSAGE) {
+      this.#track(event.id, 1);
+    }
+    ws.send(frame);
+  }
+
+  // stop asks the connector to stop the run started by the user_message
+  // with eventId, or every run of the session when eventId is empty.
+  stop(eventId) {
+    return this.send(eventId ? { type: "control", action: "stop", id: eventId } : { type: "control", action: "stop" });
+  }
+
+  // uploadAttachment streams data as attachment chunks and resolves with
+  // the ref to list in the attachments of the next user_message.
+  async uploadAttachment(data, { mimeType = "", name = "" } = {}) {
+    const bytes = typeof Blob !== "undefined" && data instanceof Blob ? new Uint8Array(await data.arrayBuffer()) : toBytes(data);
+    const ws = await this.#connected();
+    const id = `a${Date.now().toString(36)}_${this.#attachmentSeq++}`;
+    for (const chunk of splitAttachment(id, bytes)) {
+      ws.send(buildDataFrame(this.#sessionId, FLAG_ATTACHMENT, encodeAttachmentChunk(chunk)));
+    }
+    return { id, mimeType, name, size: bytes.length };
+  }
+
+  // close sends CLOSE_SESSION and ends the session.
+  close() {
+    if (this.#closed) {
+      return;
+    }
+    const ws = this.#ws;
+    if (ws) {
+      this.#detach(ws);
+      try {
+        ws.send(encodeControl({ type: ControlType.CLOSE_SESSION, session_id: this.#sessionId }));
+      } catch {
+        // The socket is already going away.
+      }
+      ws.close(1000);
+    }
+    this.#finish(null);
+  }
+
+  async #connected() {
+    for (;;) {
+      if (this.#closed) {
+        throw new ClosedError();
+      }
+      if (!this.#started) {
+        throw new Error("not connected; call connect() first");
+      }
+      if (this.#ws) {
+        return this.#ws;
+      }
+      await this.#ready;
+    }
+  }
+
+  #handshake() {
+    return new Promise((resolve, reject) => {
+      const ws = new this.#options.WebSocket(this.#url);
+      ws.binaryType = "arraybuffer";
+      const fail = (err) => {
+        ws.onclose = null;
+        ws.close();
+        reject(err);
+      };
+      ws.onopen = () => {
+        // The client handles attachment chunks, so it always offers them,
+        // and it implements no payload compression.
+        ws.send(
+          encodeControl({
+            type: ControlType.CONNECT,
+            v: SUPPORTED_VERSIONS[0],
+            versions: [...SUPPORTED_VERSIONS],
+            access_code: this.#accessCode,
+            caps: { e2ee: false, ...this.#options.caps, attachments: true, compression: undefined },
+          }),
+        );
+      };
+      ws.onmessage = (ev) => {
+        if (typeof ev.data !== "string") {
+          return;
+        }
+        let msg;
+        try {
+          msg = decodeControl(ev.data);
+        } catch (err) {
+          if (/unsupported protocol version/.test(err.message)) {
+            fail(err);
+          }
+          return;
+        }
+        if (msg.type === ControlType.CONNECT_OK) {
+          if (!msg.session_id) {
+            fail(new Error("missing session_id"));
+            return;
+          }
+          resolve({ ws, sessionId: msg.session_id, version: msg.v, caps: msg.caps || { e2ee: false } });
+        } else if (msg.type === ControlType.ERROR) {
+          fail(new ConnectError(msg.code, msg.message));
+        }
+      };
+      ws.onerror = () => {};
+      ws.onclose = (ev) => reject(new Error(`connect relay: socket closed (${ev.code})`));
+    });
+  }
+
+  #attach({ ws, sessionId, version, caps }) {
+    this.#ws = ws;
+    this.#sessionId = sessionId;
+    this.#version = version;
+    this.#caps = caps;
+    this.#media = new MediaAssembler();
+    ws.onmessage = (ev) => this.#receive(ev.data);
+    ws.onerror = () => {};
+    ws.onclose = (ev) => this.#lost(new Error(`connection closed (${ev.code})`));
+    this.#readyResolve();
+  }
+
+  #detach(ws) {
+    ws.onmessage = null;
+    ws.onclose = null;
+    this.#ws = null;
+    this.#resetReady();
+  }
+
+  #resetReady() {
+    this.#ready = new Promise((resolve) => {
+      this.#readyResolve = resolve;
+    });
+  }
+
+  #receive(data) {
+    if (typeof data === "string") {
+      let msg;
+      try {
+        msg = decodeControl(data);
+      } catch {
+        return;
+      }
+      if (msg.type === ControlType.CLOSE_SESSION && msg.session_id === this.#sessionId) {
+        const ws = this.#ws;
+        this.#lost(new ClosedError("session closed by relay"));
+        ws.close();
+      }
+      return;
+    }
+
+    let frame;
+    try {
+      frame = parseDataFrame(data);
+    } catch {
+      return;
+    }
+    if (frame.sessionId !== this.#sessionId) {
+      return;
+    }
+    if (frame.flags & FLAG_ATTACHMENT) {
+      this.#media.add(frame.payload);
+      return;
+    }
+    let event;
+    try {
+      event = decodeEvent(frame.payload);
+    } catch {
+      return;
+    }
+    if (event.type === EventType.MEDIA) {
+      this.#media.resolve(event);
+    }
+    if (event.type === EventType.END || event.type === EventType.ERROR) {
+      this.#track(event.id, -1);
+    }
+    this.#emit("event", event);
+  }
+
+  // lost handles a dropped connection: runs in flight end with a
+  // CONNECTION_LOST error event, then the client reconnects or closes.
+  #lost(err) {
+    const ws = this.#ws;
+    if (!ws) {
+      return;
+    }
+    this.#detach(ws);
+    this.#emit("disconnect", err);
+    for (const [id, n] of this.#inflight) {
+      for (let i = 0; i < n; i++) {
+        this.#emit("event", { type: EventType.ERROR, ...(id ? { id } : {}), code: "CONNECTION_LOST", message: err.message });
+      }
+    }
+    this.#inflight.clear();
+    if (!this.#options.reconnect) {
+      this.#finish(err);
+      return;
+    }
+    this.#reconnect();
+  }
+
+  async #reconnect() {
+    while (!this.#closed) {
+      await new Promise((resolve) => setTimeout(resolve, this.#options.reconnectDelay));
+      if (this.#closed) {
+        return;
+      }
+      let session;
+      try {
+        session = await this.#handshake();
+      } catch {
+        continue;
+      }
+      if (this.#closed) {
+        session.ws.close(1000);
+        return;
+      }
+      this.#attach(session);
+      this.#emit("reconnect", session.sessionId);
+      return;
+    }
+  }
+
+  #finish(err) {
+    if (this.#closed) {
+      return;
+    }
+    this.#closed = true;
+    this.#error = err;
+    this.#readyResolve();
+    this.#emit("close", err);
+  }
+
+  #track(id, delta) {
+    const key = id || "";
+    const n = (this.#inflight.get(key) || 0) + delta;
+    if (n > 0) {
+      this.#inflight.set(key, n);
+    } else {
+      this.#inflight.delete(key);
+    }
+  }
+
+  #emit(type, detail) {
+    this.dispatchEvent(new CustomEvent(type, { detail }));
+  }
+}
@@ -0,0 +1,260 @@
+// Run with: node --test web/sdk/ (go test ./web/sdk runs it when node is
+// installed).
+import assert from "node:assert/strict";
+import { readFileSync } from "node:fs";
+import { test } from "node:test";
+
+import {
+  BridgeClient,
+  ClosedError,
+  ConnectError,
+  ControlType,
+  EventType,
+  FLAG_ATTACHMENT,
+  FLAG_COMPRESSED,
+  FLAG_E2EE,
+  OPTIONAL_EVENTS,
+  PROTOCOL_VERSION,
+  SUPPORTED_VERSIONS,
+  buildDataFrame,
+  decodeAttachmentChunk,
+  decodeControl,
+  encodeAttachmentChunk,
+  encodeControl,
+  encodeEvent,
+  parseDataFrame,
+  splitAttachment,
+} from "./openclaw-bridge.js";
+
+const vectors = JSON.parse(readFileSync(new URL("../../shared/protocol/testdata/vectors.json", import.meta.url)));
+
+const hex = (s) => Uint8Array.from(s.match(/../g) || [], (b) => parseInt(b, 16));
+const toHex = (bytes) => Buffer.from(bytes).toString("hex");
+
+test("constants match shared/protocol", () => {
+  assert.equal(PROTOCOL_VERSION, vectors.version);
+  assert.deepEqual([...SUPPORTED_VERSIONS], vectors.supported_versions);
+  assert.deepEqual({ e2ee: FLAG_E2EE, attachment: FLAG_ATTACHMENT, compressed: FLAG_COMPRESSED }, vectors.flags);
+  assert.deepEqual(Object.values(ControlType), vectors.control_types);
+  assert.deepEqual(Object.values(EventType), vectors.event_types);
+  assert.deepEqual([...OPTIONAL_EVENTS], vectors.optional_events);
+});
+
+test("data frame vectors", () => {
+  for (const v of vectors.data_frames) {
+    assert.equal(toHex(buildDataFrame(v.session_id, v.flags, hex(v.payload_hex))), v.frame_hex, v.name);
+    const frame = parseDataFrame(hex(v.frame_hex).buffer);
+    assert.equal(frame.sessionId, v.session_id, v.name);
+    assert.equal(frame.flags, v.flags, v.name);
+    assert.equal(toHex(frame.payload), v.payload_hex, v.name);
+  }
+  for (const v of vectors.invalid_data_frames) {
+    assert.throws(() => parseDataFrame(hex(v.hex)), Error, v.name);
+  }
+});
+
+test("attachment chunk vectors", () => {
+  for (const v of vectors.attachment_chunks) {
+    const chunk = { id: v.id, offset: v.offset, final: v.final, data: hex(v.data_hex) };
+    assert.equal(toHex(encodeAttachmentChunk(chunk)), v.chunk_hex, v.name);
+    const decoded = decodeAttachmentChunk(hex(v.chunk_hex));
+    assert.deepEqual({ ...decoded, data: toHex(decoded.data) }, { ...chunk, data: v.data_hex }, v.name);
+  }
+  for (const v of vectors.invalid_attachment_chunks) {
+    assert.throws(() => decodeAttachmentChunk(hex(v.hex)), Error, v.name);
+  }
+  const chunks = splitAttachment("a", new Uint8Array(5), 2);
+  assert.deepEqual(
+    chunks.map((c) => [c.offset, c.data.length, c.final]),
+    [
+      [0, 2, false],
+      [2, 2, false],
+      [4, 1, true],
+    ],
+  );
+  assert.equal(splitAttachment("a", new Uint8Array()).length, 1);
+});
+
+test("control vectors", () => {
+  for (const v of vectors.controls) {
+    assert.deepEqual(decodeControl(v.json), v.decoded, v.name);
+    assert.deepEqual(JSON.parse(encodeControl(v.decoded)), JSON.parse(v.json), v.name);
+  }
+  for (const v of vectors.invalid_controls) {
+    assert.throws(() => decodeControl(v.json), Error, v.name);
+  }
+});
+
+// FakeRelay stands in for the relay /client endpoint. Each socket the
+// client opens is answered by the handler given to the test.
+class FakeRelay {
+  sockets = [];
+
+  constructor(onConnect) {
+    const relay = this;
+    this.onConnect = onConnect;
+    this.WebSocket = class {
+      sent = [];
+      readyState = 0;
+
+      constructor(url) {
+        this.url = url;
+        relay.sockets.push(this);
+        setTimeout(() => {
+          this.readyState = 1;
+          this.onopen?.();
+        });
+      }
+
+      send(data) {
+        this.sent.push(typeof data === "string" ? decodeControl(data) : parseDataFrame(data));
+        if (typeof data === "string" && this.sent.length === 1) {
+          setTimeout(() => relay.onConnect(this, this.sent[0]));
+        }
+      }
+
+      close(code = 1005) {
+        if (this.readyState === 3) {
+          return;
+        }
+        this.readyState = 3;
+        setTimeout(() => this.onclose?.({ code }));
+      }
+
+      control(msg) {
+        this.onmessage?.({ data: encodeControl(msg) });
+      }
+
+      event(sessionId, event) {
+        this.onmessage?.({ data: buildDataFrame(sessionId, 0, encodeEvent(event)).buffer });
+      }
+
+      drop() {
+        this.close(1006);
+      }
+    };
+  }
+
+  get last() {
+    return this.sockets[this.sockets.length - 1];
+  }
+}
+
+function accept(sessionId, caps = { e2ee: false, attachments: true }) {
+  return (ws) => ws.control({ type: ControlType.CONNECT_OK, session_id: sessionId, caps });
+}
+
+function next(target, type) {
+  return new Promise((resolve) => target.addEventListener(type, (e) => resolve(e.detail), { once: true }));
+}
+
+test("connect, stream and stop", async () => {
+  const relay = new FakeRelay(accept("s_1"));
+  const client = new BridgeClient("ws://relay/client", "A-1", { caps: { e2ee: false, events: ["media"] }, WebSocket: relay.WebSocket });
+  assert.equal(await client.connect(), "s_1");
+  const ws = relay.last;
+  assert.deepEqual(ws.sent[0], {
+    type: ControlType.CONNECT,
+    v: SUPPORTED_VERSIONS[0],
+    versions: [...SUPPORTED_VERSIONS],
+    access_code: "A-1",
+    caps: { e2ee: false, events: ["media"], attachments: true },
+  });
+  assert.equal(client.version, PROTOCOL_VERSION);
+  assert.deepEqual(client.caps, { e2ee: false, attachments: true });
+
+  const events = [];
+  client.addEventListener("event", (e) => events.push(e.detail));
+  await client.send({ type: EventType.USER_MESSAGE, id: "m1", content: "hi" });
+  await client.stop("m1");
+  assert.deepEqual(
+    ws.sent.slice(1).map((f) => [f.sessionId, JSON.parse(Buffer.from(f.payload))]),
+    [
+      ["s_1", { type: "user_message", id: "m1", content: "hi" }],
+      ["s_1", { type: "control", action: "stop", id: "m1" }],
+    ],
+  );
+
+  ws.event("s_other", { type: EventType.TOKEN, id: "x", content: "not ours" });
+  ws.event("s_1", { type: EventType.TOKEN, id: "m1", content: "hel" });
+  for (const chunk of splitAttachment("a1", Uint8Array.of(1, 2, 3), 2)) {
+    ws.onmessage({ data: buildDataFrame("s_1", FLAG_ATTACHMENT, encodeAttachmentChunk(chunk)) });
+  }
+  ws.event("s_1", { type: EventType.MEDIA, id: "m1", media: { mimeType: "image/png", attachmentId: "a1" } });
+  ws.event("s_1", { type: EventType.END, id: "m1", meta: { stopReason: "aborted" } });
+  assert.deepEqual(events, [
+    { type: "token", id: "m1", content: "hel" },
+    { type: "media", id: "m1", media: { mimeType: "image/png", bytes: Uint8Array.of(1, 2, 3) } },
+    { type: "end", id: "m1", meta: { stopReason: "aborted" } },
+  ]);
+
+  const closed = next(client, "close");
+  client.close();
+  assert.equal(await closed, null);
+  assert.deepEqual(ws.sent.at(-1), { type: ControlType.CLOSE_SESSION, v: PROTOCOL_VERSION, session_id: "s_1" });
+  await assert.rejects(client.send({ type: EventType.USER_MESSAGE, content: "late" }), ClosedError);
+});
+
+test("connect error", async () => {
+  const relay = new FakeRelay((ws) => ws.control({ type: ControlType.ERROR, code: "CONNECTOR_NOT_FOUND", message: "connector not online" }));
+  const client = new BridgeClient("ws://relay/client", "A-1", { WebSocket: relay.WebSocket });
+  await assert.rejects(client.connect(), (err) => err instanceof ConnectError && err.code === "CONNECTOR_NOT_FOUND");
+  assert.ok(client.closed);
+});
+
+test("negotiated max_frame_size limits sends", async () => {
+  const relay = new FakeRelay(accept("s_1", { e2ee: false, max_frame_size: 64 }));
+  const client = new BridgeClient("ws://relay/client", "A-1", { WebSocket: relay.WebSocket });
+  await client.connect();
+  await client.send({ type: EventType.USER_MESSAGE, id: "m1", content: "hi" });
+  await assert.rejects(client.send({ type: EventType.USER_MESSAGE, id: "m2", content: "x".repeat(64) }), /max_frame_size/);
+  assert.equal(relay.last.sent.length, 2);
+  client.close();
+});
+
+test("unsupported version in CONNECT_OK fails connect", async () => {
+  const relay = new FakeRelay((ws) => ws.onmessage({ data: JSON.stringify({ type: ControlType.CONNECT_OK, v: 99, session_id: "s_1" }) }));
+  const client = new BridgeClient("ws://relay/client", "A-1", { WebSocket: relay.WebSocket });
+  await assert.rejects(client.connect(), /unsupported protocol version 99/);
+});
+
+test("reconnect fails runs in flight and resumes sending", async () => {
+  let n = 0;
+  const relay = new FakeRelay((ws) => {
+    n++;
+    if (n === 2) {
+      ws.control({ type: ControlType.ERROR, code: "CONNECTOR_NOT_FOUND", message: "connector not online" });
+      return;
+    }
+    accept(`s_${n}`)(ws);
+  });
+  const client = new BridgeClient("ws://relay/client", "A-1", { reconnect: true, reconnectDelay: 1, WebSocket: relay.WebSocket });
+  await client.connect();
+  await client.send({ type: EventType.USER_MESSAGE, id: "m1", content: "hi" });
+
+  const lost = next(client, "event");
+  const disconnected = next(client, "disconnect");
+  const reconnected = next(client, "reconnect");
+  relay.last.drop();
+  assert.match((await disconnected).message, /1006/);
+  assert.deepEqual(await lost, { type: "error", id: "m1", code: "CONNECTION_LOST", message: "connection closed (1006)" });
+
+  // Sent while reconnecting; delivered on the new session.
+  const sent = client.send({ type: EventType.USER_MESSAGE, id: "m2", content: "again" });
+  assert.equal(await reconnected, "s_3");
+  await sent;
+  assert.equal(client.sessionId, "s_3");
+  assert.equal(relay.last.sent.at(-1).sessionId, "s_3");
+  client.close();
+});
+
+test("relay closing the session ends a client without reconnect", async () => {
+  const relay = new FakeRelay(accept("s_1"));
+  const client = new BridgeClient("ws://relay/client", "A-1", { WebSocket: relay.WebSocket });
+  await client.connect();
+  const closed = next(client, "close");
+  relay.last.control({ type: ControlType.CLOSE_SESSION, session_id: "s_1" });
+  const err = await closed;
+  assert.ok(err instanceof ClosedError);
+  assert.equal(client.error, err);
+});
@@ -0,0 +1,49 @@
+// Package sdk embeds the JavaScript client so the relay can serve it to web
+// apps at a versioned path.
+package sdk
+
+import (
+	"bytes"
+	"embed"
+	"net/http"
+	"path"
+	"time"
+)
+
+// Version is the path segment the relay serves this build of the client
+// under. Bump it for changes that break existing importers.
+const Version = "v1"
+
+// Prefix is the path the relay serves the client files under.
+const Prefix = "/sdk/" + Version + "/"
+
+//go:embed openclaw-bridge.js openclaw-bridge.d.ts
+var files embed.FS
+
+var contentTypes = map[string]string{
+	".js": "text/javascript; charset=utf-8",
+	".ts": "application/typescript; charset=utf-8",
+}
+
+// Handler serves the client files below Prefix. Responses allow any origin
+// so pages hosted elsewhere can import the module.
+func Handler() http.Handler {
+	served := time.Now()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := path.Base(r.URL.Path)
+		data, err := files.ReadFile(name)
+		if err != nil || path.Dir(r.URL.Path)+"/" != Prefix {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", contentTypes[path.Ext(name)])
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		http.ServeContent(w, r, name, served, bytes.NewReader(data))
+	})
+}
@@ -0,0 +1,62 @@
+package sdk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle(Prefix, Handler())
+
+	cases := []struct {
+		method, path string
+		status       int
+		contentType  string
+	}{
+		{http.MethodGet, Prefix + "openclaw-bridge.js", http.StatusOK, "text/javascript; charset=utf-8"},
+		{http.MethodHead, Prefix + "openclaw-bridge.d.ts", http.StatusOK, "application/typescript; charset=utf-8"},
+		{http.MethodGet, Prefix + "sdk.go", http.StatusNotFound, ""},
+		{http.MethodGet, Prefix + "nested/openclaw-bridge.js", http.StatusNotFound, ""},
+		{http.MethodPost, Prefix + "openclaw-bridge.js", http.StatusMethodNotAllowed, ""},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(c.method, c.path, nil))
+		if rec.Code != c.status {
+			t.Errorf("%s %s: status %d, want %d", c.method, c.path, rec.Code, c.status)
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); got != c.contentType {
+			t.Errorf("%s %s: content type %q, want %q", c.method, c.path, got, c.contentType)
+		}
+		if rec.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Errorf("%s %s: missing CORS header", c.method, c.path)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, Prefix+"openclaw-bridge.js", nil))
+	if !strings.Contains(rec.Body.String(), "export class BridgeClient") {
+		t.Error("module body does not export BridgeClient")
+	}
+}
+
+// TestJavaScript runs the module's own tests, which check its codecs against
+// shared/protocol/testdata/vectors.json.
+func TestJavaScript(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not installed")
+	}
+	out, err := exec.Command(node, "--test", "openclaw-bridge.test.mjs").CombinedOutput()
+	if err != nil {
+		t.Fatalf("node --test: %v\n%s", err, out)
+	}
+}